@@ -2,7 +2,9 @@ package v1alpha1
 
 import (
 	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type VerbsDescription struct {
@@ -25,6 +27,23 @@ type VerbsDescription struct {
 	AltFieldMapping map[string]string `json:"altFieldMapping,omitempty"`
 }
 
+type PrinterColumn struct {
+	// Name: the header of the column shown by kubectl get
+	// +required
+	Name string `json:"name"`
+	// Type: the OpenAPI type of the column value [string, integer, number, boolean, date]
+	// +kubebuilder:validation:Enum=string;integer;number;boolean;date
+	// +optional
+	Type string `json:"type,omitempty"`
+	// JSONPath: the path of the value to show, relative to the generated resource (e.g. .spec.name or .status.id)
+	// +kubebuilder:validation:Pattern=`^\.(spec|status)\.`
+	// +required
+	JSONPath string `json:"jsonPath"`
+	// Priority: columns with a priority greater than 0 are only shown in wide mode (-o wide)
+	// +optional
+	Priority int `json:"priority,omitempty"`
+}
+
 type Resource struct {
 	// Name: the name of the resource to manage
 	// +immutable
@@ -35,16 +54,206 @@ type Resource struct {
 	// Identifier
 	// +optional
 	Identifier string `json:"identifier,omitempty"`
+	// AdditionalPrinterColumns: the list of spec or status fields to show by kubectl get, next to the identifier
+	// +optional
+	AdditionalPrinterColumns []PrinterColumn `json:"additionalPrinterColumns,omitempty"`
+	// Plural: the plural name of the generated resource - defaults to the lowercase pluralized kind
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +immutable
+	// +optional
+	Plural string `json:"plural,omitempty"`
+	// Scope: whether the generated resource is namespaced or cluster scoped [Namespaced, Cluster] - the authentication references of a cluster scoped resource are resolved in the namespace of the Definition
+	// +kubebuilder:validation:Enum=Namespaced;Cluster
+	// +kubebuilder:default=Namespaced
+	// +immutable
+	// +optional
+	Scope ResourceScope `json:"scope,omitempty"`
+	// Singular: the singular name of the generated resource - defaults to the lowercase kind
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +immutable
+	// +optional
+	Singular string `json:"singular,omitempty"`
+	// ShortNames: the short names of the generated resource (e.g. kubectl get repo)
+	// +optional
+	ShortNames []string `json:"shortNames,omitempty"`
+	// MaxRecursionDepth: how many times a recursive schema is nested in itself before the recursion is cut and replaced by a free-form field
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	MaxRecursionDepth int `json:"maxRecursionDepth,omitempty"`
+}
+
+// ResourceScope is the scope of a generated resource.
+type ResourceScope string
+
+const (
+	// NamespacedScope generates resources living in a namespace.
+	NamespacedScope ResourceScope = "Namespaced"
+	// ClusterScope generates cluster scoped resources.
+	ClusterScope ResourceScope = "Cluster"
+)
+
+// ControllerProfile configures the deployment of the controller reconciling
+// the generated resources. Unset fields take the defaults of the provider.
+type ControllerProfile struct {
+	// Image: the repository of the controller image (e.g. ghcr.io/matteogastaldello/composition-dynamic-controller)
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Tag: the tag of the controller image
+	// +optional
+	Tag string `json:"tag,omitempty"`
+	// ImagePullSecrets: the names of the secrets used to pull the controller image
+	// +optional
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// Replicas: the number of replicas of the controller
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// LogLevel: the log level of the controller [Debug, Info]
+	// +kubebuilder:validation:Enum=Debug;Info
+	// +optional
+	LogLevel string `json:"logLevel,omitempty"`
+	// Resources: the compute resources of the controller container
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector: the labels of the nodes the controller can be scheduled on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations: the tolerations of the controller pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity: the scheduling constraints of the controller pods
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// ExtraArgs: the arguments appended to the ones of the controller container
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+	// Env: the environment variables of the controller container
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+}
+
+// ControllerChart is the Helm chart installing the controller reconciling
+// the generated resources.
+type ControllerChart struct {
+	// URL: the URL of the chart archive or its OCI reference (e.g. oci://ghcr.io/org/charts/controller) - defaults to the chart embedded in the provider
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Version: the version of the chart, required by OCI references
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Values: the values merged over the ones computed from the Definition
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+}
+
+// ControllerObject references an object installed by the controller chart.
+type ControllerObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// BreakingChangesPolicy decides how breaking CRD schema changes are handled.
+type BreakingChangesPolicy string
+
+const (
+	// BreakingChangesApply applies the breaking changes anyway.
+	BreakingChangesApply BreakingChangesPolicy = "Apply"
+	// BreakingChangesHold keeps the installed CRD until the changes are reverted.
+	BreakingChangesHold BreakingChangesPolicy = "Hold"
+	// BreakingChangesRequireNewVersion applies the breaking changes only
+	// when they are published with a new version.
+	BreakingChangesRequireNewVersion BreakingChangesPolicy = "RequireNewVersion"
+)
+
+type SchemaChange struct {
+	// Path: the path of the changed field, prefixed by the version
+	Path string `json:"path"`
+	// Severity: the severity of the change [Additive, Risky, Breaking]
+	Severity string `json:"severity"`
+	// Message: the description of the change
+	Message string `json:"message"`
+}
+
+type SchemaChanges struct {
+	// Severity: the highest severity among the changes [None, Additive, Risky, Breaking]
+	Severity string `json:"severity"`
+	// Applied: whether the changes have been applied to the installed CRD
+	Applied bool `json:"applied"`
+	// Changes: the list of the schema changes
+	// +optional
+	Changes []SchemaChange `json:"changes,omitempty"`
+}
+
+// AnnotationKeyApprovedPreview approves the installation of the CRDs
+// generated in preview mode: its value is the digest of the approved preview.
+const AnnotationKeyApprovedPreview = "swaggergen.krateo.io/approved-preview"
+
+// PreviewStatus describes the CRDs generated in preview mode.
+type PreviewStatus struct {
+	// ConfigMap: the name of the ConfigMap holding the generated CRDs and their schema changes
+	ConfigMap string `json:"configMap"`
+	// Digest: the digest of the generated CRDs, the value of the approval annotation installing them
+	Digest string `json:"digest"`
+	// ObservedGeneration: the generation of the Definition the CRDs were generated from
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// SourceDigest: the digest of the swagger file the CRDs were generated from
+	// +optional
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	// Installed: whether the generated CRDs have been installed
+	Installed bool `json:"installed"`
 }
 
 // DefinitionSpec is the specification of a Definition.
 type DefinitionSpec struct {
 	rtv1.ManagedSpec `json:",inline"`
-	// Represent the path to the swagger file
+	// Represent the path to the swagger file - a URL, a local path, or a bundle archive
+	// followed by the path of the root document in it (e.g. https://example.com/specs.tgz//openapi.yaml)
 	SwaggerPath string `json:"swaggerPath"`
+	// AllowedHosts: the hosts remote $refs may be fetched from, besides the host of the swagger file, and the download of the controller chart may be redirected to
+	// +optional
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
 	// Group: the group of the resource to manage
 	// +immutable
 	ResourceGroup string `json:"resourceGroup"`
+	// Version: the version of the generated resources - changing it adds a new served version
+	// and makes it the storage version, previous versions keep being served
+	// +kubebuilder:validation:Pattern=`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`
+	// +kubebuilder:default=v1alpha1
+	// +optional
+	Version string `json:"version,omitempty"`
+	// BreakingChangesPolicy: what to do when a regenerated CRD introduces breaking changes
+	// (removed fields, type changes, narrowed enums) [Apply, Hold, RequireNewVersion]
+	// +kubebuilder:validation:Enum=Apply;Hold;RequireNewVersion
+	// +kubebuilder:default=Hold
+	// +optional
+	BreakingChangesPolicy BreakingChangesPolicy `json:"breakingChangesPolicy,omitempty"`
+	// DeployController: whether to deploy the composition-dynamic-controller reconciling the generated resources
+	// +kubebuilder:default=true
+	// +optional
+	DeployController *bool `json:"deployController,omitempty"`
+	// ControllerProfile: how the controller reconciling the generated resources is deployed
+	// +optional
+	ControllerProfile *ControllerProfile `json:"controllerProfile,omitempty"`
+	// ControllerChart: the Helm chart installing the controller, in place of the built-in manifests
+	// +optional
+	ControllerChart *ControllerChart `json:"controllerChart,omitempty"`
+	// Preview: generate the CRDs without installing them - they are written, along with their schema changes,
+	// to the ConfigMap referenced by status.preview and installed once the swaggergen.krateo.io/approved-preview
+	// annotation is set to status.preview.digest
+	// +optional
+	Preview bool `json:"preview,omitempty"`
 	// The resource to manage
 	// +optional
 	Resource Resource `json:"resource"`
@@ -55,6 +264,27 @@ type DefinitionStatus struct {
 	rtv1.ManagedStatus `json:",inline"`
 
 	Created bool `json:"created"`
+	// Version: the version of the generated resources last installed
+	// +optional
+	Version string `json:"version,omitempty"`
+	// SchemaChanges: the changes between the installed and the last generated CRD schema
+	// +optional
+	SchemaChanges *SchemaChanges `json:"schemaChanges,omitempty"`
+	// Digest: the digest of the swagger file and of the files it references, as last installed
+	// +optional
+	Digest string `json:"digest,omitempty"`
+	// ControllerDeployment: the name of the deployment of the controller reconciling the generated resources
+	// +optional
+	ControllerDeployment string `json:"controllerDeployment,omitempty"`
+	// ControllerObjects: the objects installed by the controller chart
+	// +optional
+	ControllerObjects []ControllerObject `json:"controllerObjects,omitempty"`
+	// ControllerDigest: the digest of the configuration of the installed controller
+	// +optional
+	ControllerDigest string `json:"controllerDigest,omitempty"`
+	// Preview: the CRDs generated in preview mode
+	// +optional
+	Preview *PreviewStatus `json:"preview,omitempty"`
 	// // Resource: the generated custom resource
 	// // +optional
 	// Resources  `json:"resource,omitempty"`
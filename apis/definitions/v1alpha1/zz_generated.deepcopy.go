@@ -21,9 +21,106 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerChart) DeepCopyInto(out *ControllerChart) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerChart.
+func (in *ControllerChart) DeepCopy() *ControllerChart {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerChart)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerObject) DeepCopyInto(out *ControllerObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerObject.
+func (in *ControllerObject) DeepCopy() *ControllerObject {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerProfile) DeepCopyInto(out *ControllerProfile) {
+	*out = *in
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraArgs != nil {
+		in, out := &in.ExtraArgs, &out.ExtraArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerProfile.
+func (in *ControllerProfile) DeepCopy() *ControllerProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Definition) DeepCopyInto(out *Definition) {
 	*out = *in
@@ -87,6 +184,26 @@ func (in *DefinitionList) DeepCopyObject() runtime.Object {
 func (in *DefinitionSpec) DeepCopyInto(out *DefinitionSpec) {
 	*out = *in
 	out.ManagedSpec = in.ManagedSpec
+	if in.AllowedHosts != nil {
+		in, out := &in.AllowedHosts, &out.AllowedHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeployController != nil {
+		in, out := &in.DeployController, &out.DeployController
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ControllerProfile != nil {
+		in, out := &in.ControllerProfile, &out.ControllerProfile
+		*out = new(ControllerProfile)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ControllerChart != nil {
+		in, out := &in.ControllerChart, &out.ControllerChart
+		*out = new(ControllerChart)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Resource.DeepCopyInto(&out.Resource)
 }
 
@@ -104,6 +221,21 @@ func (in *DefinitionSpec) DeepCopy() *DefinitionSpec {
 func (in *DefinitionStatus) DeepCopyInto(out *DefinitionStatus) {
 	*out = *in
 	in.ManagedStatus.DeepCopyInto(&out.ManagedStatus)
+	if in.SchemaChanges != nil {
+		in, out := &in.SchemaChanges, &out.SchemaChanges
+		*out = new(SchemaChanges)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ControllerObjects != nil {
+		in, out := &in.ControllerObjects, &out.ControllerObjects
+		*out = make([]ControllerObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(PreviewStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DefinitionStatus.
@@ -116,6 +248,36 @@ func (in *DefinitionStatus) DeepCopy() *DefinitionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrinterColumn) DeepCopyInto(out *PrinterColumn) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrinterColumn.
+func (in *PrinterColumn) DeepCopy() *PrinterColumn {
+	if in == nil {
+		return nil
+	}
+	out := new(PrinterColumn)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreviewStatus) DeepCopyInto(out *PreviewStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreviewStatus.
+func (in *PreviewStatus) DeepCopy() *PreviewStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PreviewStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resource) DeepCopyInto(out *Resource) {
 	*out = *in
@@ -126,6 +288,16 @@ func (in *Resource) DeepCopyInto(out *Resource) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.AdditionalPrinterColumns != nil {
+		in, out := &in.AdditionalPrinterColumns, &out.AdditionalPrinterColumns
+		*out = make([]PrinterColumn, len(*in))
+		copy(*out, *in)
+	}
+	if in.ShortNames != nil {
+		in, out := &in.ShortNames, &out.ShortNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Resource.
@@ -138,6 +310,41 @@ func (in *Resource) DeepCopy() *Resource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaChange) DeepCopyInto(out *SchemaChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaChange.
+func (in *SchemaChange) DeepCopy() *SchemaChange {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaChanges) DeepCopyInto(out *SchemaChanges) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]SchemaChange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaChanges.
+func (in *SchemaChanges) DeepCopy() *SchemaChanges {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaChanges)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VerbsDescription) DeepCopyInto(out *VerbsDescription) {
 	*out = *in
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	definition "github.com/matteogastaldello/swaggergen-provider/internal/controllers/definition"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/deployment"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/code"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultNamespace = "default"
+
+type generateOptions struct {
+	// Definition is the path of the Definition manifest.
+	Definition string
+	// OAS overrides the swagger path of the Definition.
+	OAS string
+	// OutputDir is the directory the manifests are written to, one file
+	// each; when empty they are written to Out as a multi document YAML.
+	OutputDir string
+	// Controller adds the manifests of the controller to the output.
+	Controller bool
+	Out        io.Writer
+	Log        func(msg string, keysAndValues ...any)
+}
+
+// generate runs the generation pipeline of the provider against a
+// Definition manifest and writes the resulting CRDs, and optionally the
+// controller manifests, without connecting to a cluster.
+func generate(ctx context.Context, opts generateOptions) error {
+	cr, err := readDefinition(opts.Definition)
+	if err != nil {
+		return err
+	}
+	if len(opts.OAS) > 0 {
+		cr.Spec.SwaggerPath = opts.OAS
+	}
+	if len(cr.Spec.SwaggerPath) == 0 {
+		return fmt.Errorf("definition '%s' has no swagger path", cr.Name)
+	}
+
+	doc, err := definition.LoadDocument(ctx, cr.Spec.SwaggerPath, specfetch.Options{
+		AllowedHosts: cr.Spec.AllowedHosts,
+	})
+	if err != nil {
+		return err
+	}
+
+	gen, err := definition.GenerateCRDs(ctx, doc.Model, cr, opts.Log)
+	if err != nil {
+		return err
+	}
+	if opts.Log != nil {
+		for _, el := range gen.Results {
+			if len(el.Warnings) > 0 {
+				opts.Log("CRD generated with warnings", "kind", el.GVK.Kind, "warnings", el.Warnings)
+			}
+		}
+	}
+
+	files := []manifestFile{}
+	for _, crd := range append([]*apiextensionsv1.CustomResourceDefinition{gen.Resource}, gen.Auth...) {
+		dat, err := code.MarshalCRD(crd)
+		if err != nil {
+			return fmt.Errorf("marshalling CRD '%s': %w", crd.Name, err)
+		}
+		files = append(files, manifestFile{
+			name: fmt.Sprintf("%s_%s.yaml", crd.Spec.Group, crd.Spec.Names.Plural),
+			data: dat,
+		})
+	}
+
+	if opts.Controller {
+		objs, err := deployment.Manifests(ctx, definition.ControllerOptions(doc.Model, cr))
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.Buffer{}
+		for _, obj := range objs {
+			dat, err := marshalObject(obj)
+			if err != nil {
+				return fmt.Errorf("marshalling %s '%s': %w",
+					obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+			}
+			buf.Write(dat)
+		}
+		files = append(files, manifestFile{name: "controller.yaml", data: buf.Bytes()})
+	}
+
+	return writeManifests(opts, files)
+}
+
+type manifestFile struct {
+	name string
+	data []byte
+}
+
+func writeManifests(opts generateOptions, files []manifestFile) error {
+	if len(opts.OutputDir) == 0 {
+		for _, el := range files {
+			if _, err := opts.Out.Write(el.data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	for _, el := range files {
+		dst := filepath.Join(opts.OutputDir, el.name)
+		if err := os.WriteFile(dst, el.data, 0644); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		if opts.Log != nil {
+			opts.Log("Manifest written", "path", dst)
+		}
+	}
+	return nil
+}
+
+// readDefinition reads the Definition manifest at path, placing it in the
+// default namespace when it has none.
+func readDefinition(path string) (*definitionv1alpha1.Definition, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read definition: %w", err)
+	}
+
+	cr := &definitionv1alpha1.Definition{}
+	if err := yaml.UnmarshalStrict(dat, cr); err != nil {
+		return nil, fmt.Errorf("failed to decode definition: %w", err)
+	}
+	if cr.GroupVersionKind() != definitionv1alpha1.DefinitionGroupVersionKind {
+		return nil, fmt.Errorf("'%s' is not a Definition: %s", path, cr.GroupVersionKind())
+	}
+	if len(cr.Namespace) == 0 {
+		cr.Namespace = defaultNamespace
+	}
+	return cr, nil
+}
+
+// marshalObject returns the YAML document of obj, without the fields set by
+// the API server.
+func marshalObject(obj client.Object) ([]byte, error) {
+	dat, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]any{}
+	if err := json.Unmarshal(dat, &res); err != nil {
+		return nil, err
+	}
+	delete(res, "status")
+	if meta, ok := res["metadata"].(map[string]any); ok {
+		delete(meta, "creationTimestamp")
+	}
+
+	out, err := yaml.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("---\n"), out...), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const testDefinition = "testdata/definition.yaml"
+
+func TestGenerateOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	err := generate(context.TODO(), generateOptions{
+		Definition: testDefinition,
+		OutputDir:  dir,
+		Controller: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, el := range all {
+		got = append(got, el.Name())
+	}
+	want := []string{"controller.yaml", "example.com_basicauths.yaml", "example.com_repoes.yaml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+
+	dat, err := os.ReadFile(filepath.Join(dir, "example.com_repoes.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd := apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(dat, &crd); err != nil {
+		t.Fatal(err)
+	}
+	if crd.Name != "repoes.example.com" || crd.Spec.Names.Kind != "Repo" {
+		t.Errorf("unexpected CRD %s of kind %s", crd.Name, crd.Spec.Names.Kind)
+	}
+	if len(crd.Spec.Versions) != 1 || crd.Spec.Versions[0].Name != "v1alpha1" {
+		t.Fatalf("expected the v1alpha1 version only, got %v", crd.Spec.Versions)
+	}
+	spec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+	if _, ok := spec.Properties["name"]; !ok {
+		t.Errorf("expected the request body fields in the spec, got %v", spec.Properties)
+	}
+
+	dat, err = os.ReadFile(filepath.Join(dir, "controller.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"ServiceAccount", "ClusterRole", "Deployment"} {
+		if !bytes.Contains(dat, []byte("kind: "+kind+"\n")) {
+			t.Errorf("expected a %s in the controller manifests", kind)
+		}
+	}
+	if bytes.Contains(dat, []byte("\nstatus:")) {
+		t.Error("expected the controller manifests without a status")
+	}
+}
+
+func TestGenerateStdout(t *testing.T) {
+	out := bytes.Buffer{}
+	err := generate(context.TODO(), generateOptions{
+		Definition: testDefinition,
+		OAS:        filepath.Join("testdata", "repo.yaml"),
+		Out:        &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := strings.Split(strings.TrimPrefix(out.String(), "---\n"), "\n---\n")
+	if len(docs) != 2 {
+		t.Fatalf("expected the CRDs of the resource and of its authentication, got %d documents", len(docs))
+	}
+	for i, name := range []string{"repoes.example.com", "basicauths.example.com"} {
+		crd := apiextensionsv1.CustomResourceDefinition{}
+		if err := yaml.Unmarshal([]byte(docs[i]), &crd); err != nil {
+			t.Fatal(err)
+		}
+		if crd.Name != name {
+			t.Errorf("expected CRD %s, got %s", name, crd.Name)
+		}
+	}
+}
+
+func TestReadDefinition(t *testing.T) {
+	cr, err := readDefinition(testDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Namespace != defaultNamespace {
+		t.Errorf("expected the default namespace, got %q", cr.Namespace)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{
+			name: "unknown field",
+			manifest: `kind: Definition
+apiVersion: swaggergen.krateo.io/v1alpha1
+metadata:
+  name: repo
+spec:
+  swaggerPath: testdata/repo.yaml
+  resourceGroups: example.com
+`,
+			err: `unknown field "resourceGroups"`,
+		},
+		{
+			name: "other kind",
+			manifest: `kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: repo
+`,
+			err: "is not a Definition",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "definition.yaml")
+			if err := os.WriteFile(path, []byte(tt.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readDefinition(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+}
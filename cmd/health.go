@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	definition "github.com/matteogastaldello/swaggergen-provider/internal/controllers/definition"
+)
+
+// cacheSyncTimeout bounds the wait for the cache of a readiness check.
+const cacheSyncTimeout = time.Second
+
+// cacheSynced returns a checker passing once the informers of c are synced.
+func cacheSynced(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("cache not synced")
+		}
+		return nil
+	}
+}
+
+// workspaceWritable returns a checker passing when the temporary workspace
+// used by the generation is writable.
+func workspaceWritable() healthz.Checker {
+	return func(_ *http.Request) error {
+		return definition.CheckWorkspace()
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/krateoplatformops/provider-runtime/pkg/helpers"
@@ -54,8 +56,25 @@ func main() {
 				Default("false").
 				OverrideDefaultFromEnvar(fmt.Sprintf("%s_LEADER_ELECTION", envVarPrefix)).
 				Bool()
+		healthProbeAddr = app.Flag("health-probe-bind-address", "The address the liveness and readiness probes are served on.").
+				Default(":8081").
+				OverrideDefaultFromEnvar(fmt.Sprintf("%s_HEALTH_PROBE_BIND_ADDRESS", envVarPrefix)).
+				String()
+
+		generateCmd    = app.Command("generate", "Generate the CRDs of a Definition from a local OAS file, without a cluster.")
+		definitionPath = generateCmd.Flag("definition", "Path of the Definition manifest.").
+				Required().
+				ExistingFile()
+		oasPath = generateCmd.Flag("oas", "Path of the OAS file, overriding the swagger path of the Definition.").
+			String()
+		outputDir = generateCmd.Flag("output-dir", "Directory the manifests are written to, one file each, instead of stdout.").
+				Short('o').
+				String()
+		withController = generateCmd.Flag("controller", "Also write the manifests of the controller of the generated resources.").
+				Bool()
 	)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	app.Command("run", "Run the provider.").Default()
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	if helpers.Bool(servicePortHack) {
 		helpers.FixKubernetesServicePort()
@@ -70,6 +89,19 @@ func main() {
 		ctrl.SetLogger(zl)
 	}
 
+	if cmd == generateCmd.FullCommand() {
+		err := generate(context.Background(), generateOptions{
+			Definition: *definitionPath,
+			OAS:        *oasPath,
+			OutputDir:  *outputDir,
+			Controller: *withController,
+			Out:        os.Stdout,
+			Log:        log.Debug,
+		})
+		kingpin.FatalIfError(err, "Cannot generate CRDs")
+		return
+	}
+
 	log.Debug("Starting", "sync-period", syncPeriod.String())
 
 	cfg, err := ctrl.GetConfig()
@@ -84,9 +116,14 @@ func main() {
 		Metrics: metricsserver.Options{
 			BindAddress: ":8080",
 		},
+		HealthProbeBindAddress: *healthProbeAddr,
 	})
 	kingpin.FatalIfError(err, "Cannot create controller manager")
 
+	kingpin.FatalIfError(mgr.AddHealthzCheck("ping", healthz.Ping), "Cannot add liveness check")
+	kingpin.FatalIfError(mgr.AddReadyzCheck("cache", cacheSynced(mgr.GetCache())), "Cannot add cache readiness check")
+	kingpin.FatalIfError(mgr.AddReadyzCheck("workspace", workspaceWritable()), "Cannot add workspace readiness check")
+
 	o := controller.Options{
 		Logger:                  log,
 		MaxConcurrentReconciles: *maxReconcileRate,
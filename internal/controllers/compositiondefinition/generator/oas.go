@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
@@ -17,6 +18,9 @@ import (
 
 var g *OASSchemaGenerator
 
+// namePattern matches the names of the Kubernetes objects (DNS subdomains).
+const namePattern = `^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+
 type OASSchemaGenerator struct {
 	specByteSchema   []byte
 	statusByteSchema []byte
@@ -57,11 +61,27 @@ func GenerateByteSchemas(doc *libopenapi.DocumentModel[v3.Document], resource de
 			}
 
 			// Add auth schema references to the spec schema
+			authDescription := "AuthenticationRefs represent the reference to a CR containing the authentication information. One authentication method must be set."
+			refPattern := ""
+			if resource.Scope == definitionv1alpha1.ClusterScope {
+				// cluster scoped resources have no namespace of their own: the
+				// references are bare names, and the controller is only granted
+				// to read the authentication CRs in the namespace of the
+				// Definition (see deployment.CreateRole)
+				authDescription = "AuthenticationRefs represent the name of a CR, in the namespace of the Definition, containing the authentication information. One authentication method must be set."
+				refPattern = namePattern
+			}
 			bodySchema.Schema().Properties.Set("authenticationRefs", base.CreateSchemaProxy(&base.Schema{
 				Type:        []string{"object"},
-				Description: "AuthenticationRefs represent the reference to a CR containing the authentication information. One authentication method must be set."}))
+				Description: authDescription}))
 			bodySchema.Schema().Required = append(bodySchema.Schema().Required, "authenticationRefs")
-			for key, _ := range secByteSchema {
+			// sorted, so that the generated schema is the same across runs
+			authSchemaNames := make([]string, 0, len(secByteSchema))
+			for key := range secByteSchema {
+				authSchemaNames = append(authSchemaNames, key)
+			}
+			sort.Strings(authSchemaNames)
+			for _, key := range authSchemaNames {
 				authSchemaProxy := bodySchema.Schema().Properties.Value("authenticationRefs")
 				if authSchemaProxy == nil {
 					return fmt.Errorf("authenticationRefs schema not found for %s", verb.Path), errors
@@ -72,7 +92,7 @@ func GenerateByteSchemas(doc *libopenapi.DocumentModel[v3.Document], resource de
 					authSchemaProxy.Schema().Properties = orderedmap.New[string, *base.SchemaProxy]()
 				}
 				authSchemaProxy.Schema().Properties.Set(fmt.Sprintf("%sRef", text.FirstToLower(key)),
-					base.CreateSchemaProxy(&base.Schema{Type: []string{"string"}}))
+					base.CreateSchemaProxy(&base.Schema{Type: []string{"string"}, Pattern: refPattern}))
 			}
 
 			schema, err := bodySchema.BuildSchema()
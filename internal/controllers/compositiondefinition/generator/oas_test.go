@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/pb33f/libopenapi"
+)
+
+const testDoc = `openapi: 3.0.0
+info:
+  title: repos
+  version: 1.0.0
+paths:
+  /repos:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required:
+              - name
+              properties:
+                name:
+                  type: string
+      responses:
+        "201":
+          description: created
+components:
+  securitySchemes:
+    bearer:
+      type: http
+      scheme: bearer
+`
+
+func TestGenerateByteSchemasAuthRefs(t *testing.T) {
+	d, err := libopenapi.NewDocument([]byte(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, errs := d.BuildV3Model()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	for _, scope := range []definitionv1alpha1.ResourceScope{definitionv1alpha1.NamespacedScope, definitionv1alpha1.ClusterScope} {
+		resource := definitionv1alpha1.Resource{
+			Kind:  "Repo",
+			Scope: scope,
+			VerbsDescription: []definitionv1alpha1.VerbsDescription{
+				{Action: "create", Method: "POST", Path: "/repos"},
+			},
+		}
+		if err, _ := GenerateByteSchemas(doc, resource, "id"); err != nil {
+			t.Fatal(err)
+		}
+
+		spec := struct {
+			Properties map[string]struct {
+				Properties map[string]struct {
+					Pattern string `json:"pattern"`
+				} `json:"properties"`
+			} `json:"properties"`
+		}{}
+		if err := json.Unmarshal(g.specByteSchema, &spec); err != nil {
+			t.Fatal(err)
+		}
+		ref, ok := spec.Properties["authenticationRefs"].Properties["bearerAuthRef"]
+		if !ok {
+			t.Fatalf("%s: expected the bearerAuthRef reference, got %s", scope, g.specByteSchema)
+		}
+		// the references of cluster scoped resources are bare names
+		if got, want := len(ref.Pattern) > 0, scope == definitionv1alpha1.ClusterScope; got != want {
+			t.Errorf("%s: expected a name pattern %t, got %q", scope, want, ref.Pattern)
+		}
+	}
+}
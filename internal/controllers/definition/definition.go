@@ -4,36 +4,40 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"path"
-	"path/filepath"
 	"strings"
+	"time"
 
-	fgetter "github.com/hashicorp/go-getter"
-
+	rtv1 "github.com/krateoplatformops/provider-runtime/apis/common/v1"
 	"github.com/krateoplatformops/provider-runtime/pkg/controller"
 	"github.com/krateoplatformops/provider-runtime/pkg/event"
 	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	"github.com/krateoplatformops/provider-runtime/pkg/meta"
 	"github.com/krateoplatformops/provider-runtime/pkg/ratelimiter"
 	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
 	"github.com/pb33f/libopenapi"
 	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/krateoplatformops/provider-runtime/pkg/reconciler"
 	"github.com/krateoplatformops/provider-runtime/pkg/resource"
 
-	"github.com/matteogastaldello/swaggergen-provider/internal/controllers/compositiondefinition/generator"
 	"github.com/matteogastaldello/swaggergen-provider/internal/tools/crds"
-	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generation"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/deployment"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/schemadiff"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
 
 	//"github.com/krateoplatformops/crdgen"
 	"github.com/matteogastaldello/swaggergen-provider/internal/crdgen"
-	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
 )
 
 const (
@@ -41,6 +45,16 @@ const (
 	labelKeyGroup    = "krateo.io/crd-group"
 	labelKeyVersion  = "krateo.io/crd-version"
 	labelKeyResource = "krateo.io/crd-resource"
+
+	defaultResourceVersion = "v1alpha1"
+
+	// sweepInterval is how often the objects of the deleted Definitions
+	// are looked for.
+	sweepInterval = 10 * time.Minute
+
+	// conditionTypeSchemaChangesHeld is true while the breaking changes
+	// policy keeps the installed CRD of the resource as is.
+	conditionTypeSchemaChangesHeld rtv1.ConditionType = "SchemaChangesHeld"
 )
 
 func Setup(mgr ctrl.Manager, o controller.Options) error {
@@ -60,6 +74,36 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 		reconciler.WithLogger(log),
 		reconciler.WithRecorder(event.NewAPIRecorder(recorder)))
 
+	// the objects of the Definitions deleted while the provider was not
+	// running are swept by the leader
+	err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		sweep := func() {
+			err := deployment.Sweep(ctx, deployment.SweepOptions{
+				KubeClient: mgr.GetClient(),
+				Reader:     mgr.GetAPIReader(),
+				Log:        log.Debug,
+			})
+			if err != nil {
+				log.Info("Sweeping orphaned objects", "error", err.Error())
+			}
+		}
+
+		sweep()
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				sweep()
+			}
+		}
+	}))
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o.ForControllerRuntime()).
@@ -78,58 +122,22 @@ func (c *connector) Connect(ctx context.Context, mg resource.Managed) (reconcile
 	if !ok {
 		return nil, errors.New(errNotDefinition)
 	}
-	var err error
-	swaggerPath := cr.Spec.SwaggerPath
-
-	basePath := "/tmp/swaggergen-provider"
-	err = os.MkdirAll(basePath, os.ModePerm)
-	defer os.RemoveAll(basePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
-	}
-	const errorLocalPath = "relative paths require a module with a pwd"
-	err = fgetter.GetFile(filepath.Join(basePath, filepath.Base(swaggerPath)), swaggerPath)
-	if err != nil && err.Error() == errorLocalPath {
-		swaggerPath, err = filepath.Abs(swaggerPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get absolute path: %w", err)
-		}
-		err = fgetter.GetFile(filepath.Join(basePath, filepath.Base(swaggerPath)), swaggerPath)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to download file: %w", err)
+	doc, err := LoadDocument(ctx, cr.Spec.SwaggerPath, specfetch.Options{
+		AllowedHosts: cr.Spec.AllowedHosts,
+	})
+	if !meta.WasDeleted(cr) {
+		observeLoad(cr, doc, err)
 	}
-
-	contents, _ := os.ReadFile(path.Join(basePath, path.Base(swaggerPath)))
-	d, err := libopenapi.NewDocument(contents)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	doc, modelErrors := d.BuildV3Model()
-	if len(modelErrors) > 0 {
-		return nil, fmt.Errorf("failed to build model: %w", errors.Join(modelErrors...))
-	}
-	if doc == nil {
-		return nil, fmt.Errorf("failed to build model")
-	}
-
-	// Resolve model references
-	resolvingErrors := doc.Index.GetResolver().Resolve()
-	errs := []error{}
-	for i := range resolvingErrors {
-		c.log.Debug("Resolving error", "error", resolvingErrors[i].Error())
-		errs = append(errs, resolvingErrors[i].ErrorRef)
-	}
-	if len(resolvingErrors) > 0 {
-		return nil, fmt.Errorf("failed to resolve model references: %w", errors.Join(errs...))
+		return nil, err
 	}
 
 	return &external{
-		kube: c.kube,
-		log:  c.log,
-		doc:  doc,
-		rec:  c.recorder,
+		kube:   c.kube,
+		log:    c.log,
+		doc:    doc.Model,
+		digest: doc.Digest,
+		rec:    c.recorder,
 	}, nil
 }
 
@@ -139,7 +147,9 @@ type external struct {
 	kube client.Client
 	log  logging.Logger
 	doc  *libopenapi.DocumentModel[v3.Document]
-	rec  record.EventRecorder
+	// digest of the swagger file and of the files it references
+	digest string
+	rec    record.EventRecorder
 }
 
 func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler.ExternalObservation, error) {
@@ -148,10 +158,90 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (reconciler
 		return reconciler.ExternalObservation{}, errors.New(errNotDefinition)
 	}
 
+	if cr.Spec.Preview && !meta.WasDeleted(cr) {
+		if !previewCurrent(cr, e.digest) {
+			return reconciler.ExternalObservation{
+				ResourceExists:   cr.Status.Created,
+				ResourceUpToDate: false,
+			}, nil
+		}
+		if previewPending(cr, e.digest) {
+			if !cr.Status.Created {
+				cr.SetConditions(rtv1.Unavailable().
+					WithMessage(fmt.Sprintf("preview '%s' is waiting for approval", cr.Status.Preview.ConfigMap)))
+			}
+			return reconciler.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+			}, nil
+		}
+		if !cr.Status.Preview.Installed {
+			return reconciler.ExternalObservation{
+				ResourceExists:   cr.Status.Created,
+				ResourceUpToDate: false,
+			}, nil
+		}
+	}
+
 	if cr.Status.Created {
+		// Definitions created before the version was configurable
+		// have been generated with the default one.
+		current := cr.Status.Version
+		if len(current) == 0 {
+			current = defaultResourceVersion
+		}
+		upToDate := current == resourceVersion(cr) && cr.Status.Digest == e.digest &&
+			(cr.Spec.Preview || cr.Status.Preview == nil)
+
+		if !controllerEnabled(cr) {
+			installed := len(cr.Status.ControllerDeployment) > 0 || len(cr.Status.ControllerObjects) > 0
+			cr.SetConditions(rtv1.Available())
+			return reconciler.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: upToDate && !installed,
+			}, nil
+		}
+
+		digest, err := deployment.Digest(e.deployOptions(cr))
+		if err != nil {
+			return reconciler.ExternalObservation{}, fmt.Errorf("computing controller digest: %w", err)
+		}
+		upToDate = upToDate && cr.Status.ControllerDigest == digest
+
+		// the Deployment of a chart is the one it rendered
+		name := deployment.DeploymentName(generatedGVR(cr))
+		if cr.Spec.ControllerChart != nil {
+			name = cr.Status.ControllerDeployment
+		}
+		if len(name) == 0 {
+			cr.SetConditions(rtv1.Unavailable().
+				WithMessage("controller chart has not installed a deployment"))
+			return reconciler.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: false,
+			}, nil
+		}
+
+		dep := appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cr.Namespace,
+			},
+		}
+		exists, ready, err := deployment.LookupDeployment(ctx, e.kube, &dep)
+		if err != nil {
+			return reconciler.ExternalObservation{}, fmt.Errorf("looking up controller deployment: %w", err)
+		}
+		if ready {
+			cr.SetConditions(rtv1.Available())
+		} else {
+			cr.SetConditions(rtv1.Unavailable().
+				WithMessage(fmt.Sprintf("controller deployment '%s' is not ready", dep.Name)))
+		}
+
 		return reconciler.ExternalObservation{
 			ResourceExists:   true,
-			ResourceUpToDate: true,
+			ResourceUpToDate: upToDate && exists && cr.Status.ControllerDeployment == dep.Name,
 		}, nil
 	}
 
@@ -166,101 +256,523 @@ func (e *external) Create(ctx context.Context, mg resource.Managed) error {
 		return errors.New(errNotDefinition)
 	}
 
-	err, errors := generator.GenerateByteSchemas(e.doc, cr.Spec.Resource, cr.Spec.Resource.Identifier)
+	gen, err := e.generateCRDs(ctx, cr)
 	if err != nil {
-		return fmt.Errorf("generating byte schemas: %w", err)
+		return err
 	}
-	for _, er := range errors {
-		e.log.Debug("Generating Byte Schemas", "Error:", er)
+	if gen == nil {
+		// the preview is waiting for approval
+		return e.kube.Status().Update(ctx, cr)
 	}
 
-	resource := crdgen.Generate(ctx, crdgen.Options{
-		Managed: true,
-		WorkDir: fmt.Sprintf("gen-crds/%s", cr.Spec.Resource.Kind),
-		GVK: schema.GroupVersionKind{
-			Group:   cr.Spec.ResourceGroup,
-			Version: "v1alpha1",
-			Kind:    text.CapitaliseFirstLetter(cr.Spec.Resource.Kind),
-		},
-		Categories:             []string{strings.ToLower(cr.Spec.Resource.Kind)},
-		SpecJsonSchemaGetter:   generator.OASSpecJsonSchemaGetter(),
-		StatusJsonSchemaGetter: generator.OASStatusJsonSchemaGetter(),
-	})
+	held, err := e.installCRDs(ctx, cr, gen)
+	if err != nil {
+		e.recordIncompatible(cr, err)
+		return err
+	}
+	if held {
+		// the CRD stays as is until the changes are reverted or allowed
+		return e.kube.Status().Update(ctx, cr)
+	}
 
-	if resource.Err != nil {
-		return fmt.Errorf("generating CRD: %w", resource.Err)
+	err = e.deployController(ctx, cr)
+	if err != nil {
+		return err
+	}
+	if cr.Status.Preview != nil {
+		cr.Status.Preview.Installed = true
 	}
 
-	crd, err := crds.UnmarshalCRD(resource.Manifest)
+	cr.Status.Created = true
+	cr.Status.Version = resourceVersion(cr)
+	cr.Status.Digest = e.digest
+	err = e.kube.Status().Update(ctx, cr)
+
+	e.log.Debug("Creating Definition", "Path:", cr.Spec.SwaggerPath, "Group:", cr.Spec.ResourceGroup)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "DefinitionCreating",
+		"Definition '%s/%s' creating", cr.Spec.SwaggerPath, cr.Spec.ResourceGroup)
+	return err
+}
+
+func (e *external) Update(ctx context.Context, mg resource.Managed) error {
+	cr, ok := mg.(*definitionv1alpha1.Definition)
+	if !ok {
+		return errors.New(errNotDefinition)
+	}
+
+	gen, err := e.generateCRDs(ctx, cr)
+	if err != nil {
+		return err
+	}
+	if gen == nil {
+		// the preview is waiting for approval
+		return e.kube.Status().Update(ctx, cr)
+	}
+
+	held, err := e.installCRDs(ctx, cr, gen)
+	if err != nil {
+		e.recordIncompatible(cr, err)
+		return err
+	}
+	if held {
+		// the CRD stays as is until the changes are reverted or allowed
+		return e.kube.Status().Update(ctx, cr)
+	}
+
+	err = e.deployController(ctx, cr)
+	if err != nil {
+		return err
+	}
+	if cr.Status.Preview != nil {
+		cr.Status.Preview.Installed = true
+	}
+
+	cr.Status.Version = resourceVersion(cr)
+	cr.Status.Digest = e.digest
+	err = e.kube.Status().Update(ctx, cr)
+
+	e.log.Debug("Updating Definition", "Path:", cr.Spec.SwaggerPath, "Group:", cr.Spec.ResourceGroup, "Version:", cr.Status.Version)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "DefinitionUpdating",
+		"Definition '%s/%s' updating to version '%s'", cr.Spec.SwaggerPath, cr.Spec.ResourceGroup, cr.Status.Version)
+	return err
+}
+
+func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
+	cr, ok := mg.(*definitionv1alpha1.Definition)
+	if !ok {
+		return errors.New(errNotDefinition)
+	}
+
+	err := e.undeployChart(ctx, cr)
+	if err != nil {
+		return err
+	}
+
+	gvr := generatedGVR(cr)
+	err = e.uninstallPreviousController(ctx, cr, deployment.DeploymentName(gvr))
 	if err != nil {
-		return fmt.Errorf("unmarshalling CRD: %w", err)
+		return err
 	}
 
-	err = crds.InstallCRD(ctx, e.kube, crd)
+	err = deployment.Undeploy(ctx, deployment.UndeployOptions{
+		KubeClient: e.kube,
+		NamespacedName: types.NamespacedName{
+			Namespace: cr.Namespace,
+			Name:      cr.Name,
+		},
+		GVR: gvr,
+		Log: e.log.Debug,
+	})
 	if err != nil {
-		return fmt.Errorf("installing CRD: %w", err)
+		return fmt.Errorf("undeploying controller: %w", err)
+	}
+
+	forgetMetrics(cr)
+
+	cr.Status.Created = false
+	cr.Status.ControllerDeployment = ""
+	cr.Status.ControllerDigest = ""
+	err = e.kube.Status().Update(ctx, cr)
+
+	e.log.Debug("Deleting Definition", "Path:", cr.Spec.SwaggerPath, "Group:", cr.Spec.ResourceGroup)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "DefinitionDeleting",
+		"Definition '%s/%s' deleting", cr.Spec.SwaggerPath, cr.Spec.ResourceGroup)
+	return err
+}
+
+// deployController installs the controller of the generated resources,
+// from the built-in manifests or from the chart of the Definition, or, when
+// the Definition opts out, removes the one previously installed.
+func (e *external) deployController(ctx context.Context, cr *definitionv1alpha1.Definition) error {
+	gvr := generatedGVR(cr)
+	nn := types.NamespacedName{
+		Namespace: cr.Namespace,
+		Name:      cr.Name,
 	}
 
-	for secSchemaPair := e.doc.Model.Components.SecuritySchemes.First(); secSchemaPair != nil; secSchemaPair = secSchemaPair.Next() {
-		authSchemaName, err := generation.GenerateAuthSchemaName(secSchemaPair.Value())
+	if !controllerEnabled(cr) {
+		err := e.undeployChart(ctx, cr)
 		if err != nil {
-			e.log.Debug("Generating Auth Schema Name", "Error:", err)
-			continue
+			return err
 		}
-		resource = crdgen.Generate(ctx, crdgen.Options{
-			Managed: false,
-			WorkDir: fmt.Sprintf("gen-crds/%s", authSchemaName),
-			GVK: schema.GroupVersionKind{
-				Group:   cr.Spec.ResourceGroup,
-				Version: "v1alpha1",
-				Kind:    text.CapitaliseFirstLetter(authSchemaName),
-			},
-			Categories:             []string{strings.ToLower(cr.Spec.Resource.Kind)},
-			SpecJsonSchemaGetter:   generator.OASAuthJsonSchemaGetter(authSchemaName),
-			StatusJsonSchemaGetter: generator.StaticJsonSchemaGetter(),
+		if len(cr.Status.ControllerDeployment) == 0 {
+			cr.Status.ControllerDigest = ""
+			return nil
+		}
+
+		err = e.uninstallPreviousController(ctx, cr, "")
+		if err != nil {
+			return err
+		}
+		err = deployment.UndeployController(ctx, deployment.UndeployOptions{
+			KubeClient:     e.kube,
+			NamespacedName: nn,
+			GVR:            gvr,
+			Log:            e.log.Debug,
 		})
+		if err != nil {
+			return fmt.Errorf("undeploying controller: %w", err)
+		}
+
+		cr.Status.ControllerDeployment = ""
+		cr.Status.ControllerDigest = ""
+		return nil
+	}
+
+	opts := e.deployOptions(cr)
+	digest, err := deployment.Digest(opts)
+	if err != nil {
+		return fmt.Errorf("computing controller digest: %w", err)
+	}
 
-		if resource.Err != nil {
-			return fmt.Errorf("generating CRD: %w", resource.Err)
+	if cr.Spec.ControllerChart != nil {
+		// the objects of the built-in manifests are replaced by the
+		// ones rendered from the chart
+		if len(cr.Status.ControllerObjects) == 0 && len(cr.Status.ControllerDeployment) > 0 {
+			err := e.uninstallPreviousController(ctx, cr, "")
+			if err != nil {
+				return err
+			}
+			err = deployment.UndeployController(ctx, deployment.UndeployOptions{
+				KubeClient:     e.kube,
+				NamespacedName: nn,
+				GVR:            gvr,
+				Log:            e.log.Debug,
+			})
+			if err != nil {
+				return fmt.Errorf("undeploying controller: %w", err)
+			}
+			cr.Status.ControllerDeployment = ""
 		}
 
-		crd, err := crds.UnmarshalCRD(resource.Manifest)
+		opts.Installed = cr.Status.ControllerObjects
+		objs, err := deployment.DeployChart(ctx, opts)
+		cr.Status.ControllerObjects = objs
 		if err != nil {
-			return fmt.Errorf("unmarshalling CRD: %w", err)
+			return fmt.Errorf("deploying controller chart: %w", err)
 		}
 
-		err = crds.InstallCRD(ctx, e.kube, crd)
-		if err != nil {
-			return fmt.Errorf("installing CRD: %w", err)
+		cr.Status.ControllerDeployment = ""
+		for _, el := range objs {
+			if el.Kind == "Deployment" {
+				cr.Status.ControllerDeployment = el.Name
+				break
+			}
 		}
+		cr.Status.ControllerDigest = digest
+		return nil
 	}
 
-	// err = deployment.Deploy(ctx, deployment.DeployOptions{
-	// 	KubeClient: e.kube,
-	// 	NamespacedName: types.NamespacedName{
-	// 		Namespace: cr.Namespace,
-	// 		Name:      cr.Name,
-	// 	},
-	// 	Spec:            &cr.Spec,
-	// 	ResourceVersion: "v1alpha1",
-	// })
-	// if err != nil {
-	// 	return fmt.Errorf("deploying controller: %w", err)
-	// }
+	err = e.undeployChart(ctx, cr)
+	if err != nil {
+		return err
+	}
 
-	cr.Status.Created = true
-	err = e.kube.Status().Update(ctx, cr)
+	name := deployment.DeploymentName(gvr)
+	err = e.uninstallPreviousController(ctx, cr, name)
+	if err != nil {
+		return err
+	}
 
-	e.log.Debug("Creating Definition", "Path:", cr.Spec.SwaggerPath, "Group:", cr.Spec.ResourceGroup)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "DefinitionCreating",
-		"Definition '%s/%s' creating", cr.Spec.SwaggerPath, cr.Spec.ResourceGroup)
-	return err
+	err = deployment.Deploy(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("deploying controller: %w", err)
+	}
+
+	cr.Status.ControllerDeployment = name
+	cr.Status.ControllerDigest = digest
+	return nil
 }
 
-func (e *external) Update(ctx context.Context, mg resource.Managed) error {
+// deployOptions returns the options deploying the controller of the
+// generated resources.
+func (e *external) deployOptions(cr *definitionv1alpha1.Definition) deployment.DeployOptions {
+	owner := deployment.OwnerReference(cr)
+	opts := ControllerOptions(e.doc, cr)
+	opts.KubeClient = e.kube
+	opts.Owner = &owner
+	opts.Log = e.log.Debug
+	return opts
+}
+
+// undeployChart removes the objects installed by the controller chart, if
+// any, and forgets about them.
+func (e *external) undeployChart(ctx context.Context, cr *definitionv1alpha1.Definition) error {
+	if len(cr.Status.ControllerObjects) == 0 {
+		return nil
+	}
+
+	err := deployment.UndeployChart(ctx, deployment.UndeployChartOptions{
+		KubeClient: e.kube,
+		NamespacedName: types.NamespacedName{
+			Name:      cr.Name,
+			Namespace: cr.Namespace,
+		},
+		Objects: cr.Status.ControllerObjects,
+		Log:     e.log.Debug,
+	})
+	if err != nil {
+		return fmt.Errorf("undeploying controller chart: %w", err)
+	}
+
+	cr.Status.ControllerObjects = nil
+	cr.Status.ControllerDeployment = ""
 	return nil
 }
 
-func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
+// uninstallPreviousController removes the controller deployment recorded in
+// the status when it is not the current one, e.g. after a version change.
+func (e *external) uninstallPreviousController(ctx context.Context, cr *definitionv1alpha1.Definition, current string) error {
+	prev := cr.Status.ControllerDeployment
+	if len(prev) == 0 || prev == current {
+		return nil
+	}
+
+	err := deployment.UninstallDeployment(ctx, deployment.UninstallOptions{
+		KubeClient: e.kube,
+		NamespacedName: types.NamespacedName{
+			Namespace: cr.Namespace,
+			Name:      prev,
+		},
+		Log: e.log.Debug,
+	})
+	if err != nil {
+		return fmt.Errorf("uninstalling controller deployment '%s': %w", prev, err)
+	}
 	return nil
 }
+
+// generateCRDs generates the CRDs of the resource and of its authentication
+// methods. In preview mode they are written to the preview ConfigMap and
+// nil is returned until the preview is approved.
+func (e *external) generateCRDs(ctx context.Context, cr *definitionv1alpha1.Definition) (*Generated, error) {
+	start := time.Now()
+	gen, err := GenerateCRDs(ctx, e.doc, cr, e.log.Debug)
+	observeGeneration(cr, gen, start)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range gen.Results {
+		e.recordWarnings(cr, el)
+	}
+
+	if !cr.Spec.Preview {
+		return gen, e.removePreview(ctx, cr)
+	}
+
+	approved, err := e.writePreview(ctx, cr, gen)
+	if err != nil || !approved {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// installCRDs installs the generated CRDs of the resource and of its
+// authentication methods. It reports whether the CRD of the resource has
+// been held by the breaking changes policy, in which case nothing else is
+// installed.
+func (e *external) installCRDs(ctx context.Context, cr *definitionv1alpha1.Definition, gen *Generated) (bool, error) {
+	held, err := e.installResourceCRD(ctx, cr, gen.Resource)
+	observeInstall(cr, held, err)
+	if err != nil {
+		return false, fmt.Errorf("installing CRD: %w", err)
+	}
+	if held {
+		return true, nil
+	}
+
+	for _, crd := range gen.Auth {
+		err = crds.InstallCRD(ctx, e.kube, crd)
+		observeInstall(cr, false, err)
+		if err != nil {
+			return false, fmt.Errorf("installing CRD: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+// installResourceCRD installs the CRD of the managed resource applying the
+// breaking changes policy of the Definition, and reports whether the policy
+// held the update. The schema changes with respect to the installed CRD are
+// reported in the Definition status, and as events when they change.
+func (e *external) installResourceCRD(ctx context.Context, cr *definitionv1alpha1.Definition, crd *apiextensionsv1.CustomResourceDefinition) (bool, error) {
+	cur, err := crds.GetCRD(ctx, e.kube, crd.Name)
+	if err != nil {
+		return false, err
+	}
+	if cur == nil {
+		cr.Status.SchemaChanges = nil
+		setSchemaChangesHeld(cr, "")
+		return false, crds.InstallCRD(ctx, e.kube, crd)
+	}
+
+	merged := crds.MergeVersions(cur, crd)
+	report := schemadiff.CompareCRDs(cur, merged)
+	breaking := report.Severity() == schemadiff.Breaking
+
+	apply := !breaking
+	switch cr.Spec.BreakingChangesPolicy {
+	case definitionv1alpha1.BreakingChangesApply:
+		apply = true
+	case definitionv1alpha1.BreakingChangesRequireNewVersion:
+		apply = apply || !servesVersion(cur, resourceVersion(cr))
+	}
+
+	prev := cr.Status.SchemaChanges
+	cr.Status.SchemaChanges = schemaChangesStatus(report, apply)
+	if len(report.Changes) > 0 && !equality.Semantic.DeepEqual(prev, cr.Status.SchemaChanges) {
+		eventType := corev1.EventTypeNormal
+		if breaking {
+			eventType = corev1.EventTypeWarning
+		}
+		e.rec.Eventf(cr, eventType, "SchemaChanges",
+			"CRD '%s' has %d schema changes (highest severity: %s, applied: %t)",
+			crd.Name, len(report.Changes), report.Severity(), apply)
+	}
+
+	if !apply {
+		setSchemaChangesHeld(cr, fmt.Sprintf("CRD '%s' not updated: %d schema changes held by the %s policy",
+			crd.Name, len(report.Changes), breakingChangesPolicy(cr)))
+		return true, nil
+	}
+	setSchemaChangesHeld(cr, "")
+	if breaking {
+		return false, crds.ForceInstallCRD(ctx, e.kube, crd)
+	}
+	return false, crds.InstallCRD(ctx, e.kube, crd)
+}
+
+// setSchemaChangesHeld sets the condition reporting the schema changes held
+// by the breaking changes policy, described by msg; an empty msg clears it.
+func setSchemaChangesHeld(cr *definitionv1alpha1.Definition, msg string) {
+	cond := rtv1.Condition{
+		Type:               conditionTypeSchemaChangesHeld,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "BreakingChanges",
+		Message:            msg,
+	}
+	if len(msg) == 0 {
+		if cr.GetCondition(conditionTypeSchemaChangesHeld).Status != metav1.ConditionTrue {
+			return
+		}
+		cond.Status, cond.Reason = metav1.ConditionFalse, "Applied"
+	}
+	cr.SetConditions(cond)
+}
+
+// breakingChangesPolicy returns the breaking changes policy of the
+// Definition, Hold unless specified.
+func breakingChangesPolicy(cr *definitionv1alpha1.Definition) definitionv1alpha1.BreakingChangesPolicy {
+	if len(cr.Spec.BreakingChangesPolicy) > 0 {
+		return cr.Spec.BreakingChangesPolicy
+	}
+	return definitionv1alpha1.BreakingChangesHold
+}
+
+// recordIncompatible emits a warning event when a CRD update has been
+// refused because it would make the stored objects unreadable.
+func (e *external) recordIncompatible(cr *definitionv1alpha1.Definition, err error) {
+	var incompatible *crds.IncompatibleError
+	if !errors.As(err, &incompatible) {
+		return
+	}
+
+	e.log.Info("CRD update blocked", "name", incompatible.Name, "reasons", incompatible.Reasons)
+	e.rec.Eventf(cr, corev1.EventTypeWarning, "CRDUpdateBlocked",
+		"CRD '%s' not updated: %s", incompatible.Name, strings.Join(incompatible.Reasons, "; "))
+}
+
+// recordWarnings reports the warnings raised while generating a CRD.
+func (e *external) recordWarnings(cr *definitionv1alpha1.Definition, res crdgen.Result) {
+	if len(res.Warnings) == 0 {
+		return
+	}
+
+	e.log.Info("CRD generated with warnings", "kind", res.GVK.Kind, "warnings", res.Warnings)
+	e.rec.Eventf(cr, corev1.EventTypeWarning, "CRDGenerationWarnings",
+		"CRD of '%s' generated with warnings: %s", res.GVK.Kind, strings.Join(res.Warnings, "; "))
+}
+
+func schemaChangesStatus(report schemadiff.Report, applied bool) *definitionv1alpha1.SchemaChanges {
+	res := &definitionv1alpha1.SchemaChanges{
+		Severity: string(report.Severity()),
+		Applied:  applied,
+	}
+	for _, el := range report.Changes {
+		res.Changes = append(res.Changes, definitionv1alpha1.SchemaChange{
+			Path:     el.Path,
+			Severity: string(el.Severity),
+			Message:  el.Message,
+		})
+	}
+	return res
+}
+
+func servesVersion(crd *apiextensionsv1.CustomResourceDefinition, version string) bool {
+	for _, el := range crd.Spec.Versions {
+		if el.Name == version {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceVersion returns the version of the generated resources.
+func resourceVersion(cr *definitionv1alpha1.Definition) string {
+	if len(cr.Spec.Version) > 0 {
+		return cr.Spec.Version
+	}
+	return defaultResourceVersion
+}
+
+// generatedGVR returns the group, version and resource of the generated kind.
+func generatedGVR(cr *definitionv1alpha1.Definition) schema.GroupVersionResource {
+	return deployment.ToGroupVersionResourceWithPlural(schema.GroupVersionKind{
+		Group:   cr.Spec.ResourceGroup,
+		Version: resourceVersion(cr),
+		Kind:    cr.Spec.Resource.Kind,
+	}, cr.Spec.Resource.Plural)
+}
+
+// labelCRD labels a generated CRD with the Definition generating it; being
+// cluster scoped, it cannot be owned by the Definition.
+func labelCRD(cr *definitionv1alpha1.Definition, crd *apiextensionsv1.CustomResourceDefinition) {
+	if crd.Labels == nil {
+		crd.Labels = map[string]string{}
+	}
+	for k, v := range deployment.DefinitionLabels(types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}) {
+		crd.Labels[k] = v
+	}
+}
+
+// controllerEnabled reports whether the controller of the generated
+// resources has to be deployed, which is the default.
+func controllerEnabled(cr *definitionv1alpha1.Definition) bool {
+	return cr.Spec.DeployController == nil || *cr.Spec.DeployController
+}
+
+// printerColumns returns the additional 'kubectl get' columns of the generated
+// kind: the remote identifier first, followed by the columns declared on the resource.
+func printerColumns(res definitionv1alpha1.Resource) []crdgen.PrinterColumn {
+	cols := make([]crdgen.PrinterColumn, 0, len(res.AdditionalPrinterColumns)+1)
+	if len(res.Identifier) > 0 {
+		cols = append(cols, crdgen.PrinterColumn{
+			Name:     res.Identifier,
+			Type:     "string",
+			JSONPath: fmt.Sprintf(".status.%s", res.Identifier),
+		})
+	}
+
+	for _, el := range res.AdditionalPrinterColumns {
+		cols = append(cols, crdgen.PrinterColumn{
+			Name:     el.Name,
+			Type:     el.Type,
+			JSONPath: el.JSONPath,
+			Priority: el.Priority,
+		})
+	}
+
+	return cols
+}
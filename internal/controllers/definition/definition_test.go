@@ -0,0 +1,119 @@
+package definition
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/crdgen"
+)
+
+func TestPrinterColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		res  definitionv1alpha1.Resource
+		want []crdgen.PrinterColumn
+	}{
+		{
+			name: "none",
+			res:  definitionv1alpha1.Resource{Kind: "Repo"},
+			want: []crdgen.PrinterColumn{},
+		},
+		{
+			name: "identifier",
+			res:  definitionv1alpha1.Resource{Kind: "Repo", Identifier: "id"},
+			want: []crdgen.PrinterColumn{
+				{Name: "id", Type: "string", JSONPath: ".status.id"},
+			},
+		},
+		{
+			name: "identifier first",
+			res: definitionv1alpha1.Resource{
+				Kind:       "Repo",
+				Identifier: "id",
+				AdditionalPrinterColumns: []definitionv1alpha1.PrinterColumn{
+					{Name: `Owner, "login"`, Type: "string", JSONPath: ".spec.owner", Priority: 1},
+					{Name: "Stars", Type: "integer", JSONPath: ".status.stars"},
+				},
+			},
+			want: []crdgen.PrinterColumn{
+				{Name: "id", Type: "string", JSONPath: ".status.id"},
+				{Name: `Owner, "login"`, Type: "string", JSONPath: ".spec.owner", Priority: 1},
+				{Name: "Stars", Type: "integer", JSONPath: ".status.stars"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := printerColumns(tc.res)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInstallResourceCRDHeld(t *testing.T) {
+	installed := testCRD("repoes.github.com", map[string]apiextensionsv1.JSONSchemaProps{
+		"name":    {Type: "string"},
+		"private": {Type: "boolean"},
+	})
+
+	scheme := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	rec := record.NewFakeRecorder(10)
+	e := &external{
+		kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(installed).Build(),
+		log:  logging.NewNopLogger(),
+		rec:  rec,
+	}
+
+	cr := &definitionv1alpha1.Definition{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "repo"},
+		Spec:       definitionv1alpha1.DefinitionSpec{ResourceGroup: "github.com"},
+	}
+	// removing a field is a breaking change, held by default
+	crd := testCRD("repoes.github.com", map[string]apiextensionsv1.JSONSchemaProps{
+		"name": {Type: "string"},
+	})
+
+	for i := 0; i < 2; i++ {
+		held, err := e.installResourceCRD(context.TODO(), cr, crd)
+		if err != nil {
+			t.Fatalf("reconcile %d: expected a held update not to fail, got: %v", i, err)
+		}
+		if !held {
+			t.Fatalf("reconcile %d: expected the update to be held", i)
+		}
+	}
+
+	if got := len(rec.Events); got != 1 {
+		t.Errorf("expected the schema changes to be reported once, got %d events", got)
+	}
+	if cr.Status.SchemaChanges == nil || cr.Status.SchemaChanges.Applied {
+		t.Errorf("expected the held changes in the status, got %+v", cr.Status.SchemaChanges)
+	}
+	if got := cr.GetCondition(conditionTypeSchemaChangesHeld); got.Status != metav1.ConditionTrue {
+		t.Errorf("expected the %s condition, got %+v", conditionTypeSchemaChangesHeld, got)
+	}
+
+	cur := apiextensionsv1.CustomResourceDefinition{}
+	if err := e.kube.Get(context.TODO(), client.ObjectKey{Name: crd.Name}, &cur); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cur.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["private"]; !ok {
+		t.Error("expected the installed CRD to be left as is")
+	}
+}
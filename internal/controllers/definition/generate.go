@@ -0,0 +1,253 @@
+package definition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/pb33f/libopenapi"
+	"github.com/pb33f/libopenapi/datamodel"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/controllers/compositiondefinition/generator"
+	"github.com/matteogastaldello/swaggergen-provider/internal/crdgen"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/crds"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/deployment"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generation"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
+)
+
+// workspacePrefix is the prefix of the temporary directories the swagger
+// files are fetched to.
+const workspacePrefix = "swaggergen-provider-"
+
+// CheckWorkspace verifies that a file can be written to the temporary
+// directory the swagger files are fetched to.
+func CheckWorkspace() error {
+	dir, err := os.MkdirTemp("", workspacePrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.WriteFile(filepath.Join(dir, "probe"), []byte("ok"), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// Document is an OAS document loaded along with the files it references.
+type Document struct {
+	Model *libopenapi.DocumentModel[v3.Document]
+	// Digest of the swagger file and of the files it references.
+	Digest string
+	// Size of the swagger file and of the files it references, in bytes.
+	Size int64
+	// FetchDuration is the time spent fetching the files.
+	FetchDuration time.Duration
+}
+
+// Stages of LoadDocument failing with a LoadError.
+const (
+	StageParse   = "parse"
+	StageModel   = "model"
+	StageResolve = "resolve"
+)
+
+// LoadError is a failure of LoadDocument after the files have been fetched.
+type LoadError struct {
+	Stage string
+	Err   error
+}
+
+func (e *LoadError) Error() string { return e.Err.Error() }
+
+func (e *LoadError) Unwrap() error { return e.Err }
+
+// LoadDocument fetches the swagger file at source, with the files it
+// references, and builds its resolved model.
+func LoadDocument(ctx context.Context, source string, opts specfetch.Options) (*Document, error) {
+	basePath, err := os.MkdirTemp("", workspacePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.RemoveAll(basePath)
+
+	start := time.Now()
+	spec, err := specfetch.Fetch(ctx, source, basePath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	contents, err := os.ReadFile(spec.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	fetchDuration := time.Since(start)
+
+	d, err := libopenapi.NewDocumentWithConfiguration(contents, &datamodel.DocumentConfiguration{
+		BasePath:            spec.Dir,
+		AllowFileReferences: true,
+	})
+	if err != nil {
+		return nil, &LoadError{Stage: StageParse, Err: fmt.Errorf("failed to read file: %w", err)}
+	}
+
+	doc, modelErrors := d.BuildV3Model()
+	if len(modelErrors) > 0 {
+		return nil, &LoadError{Stage: StageModel, Err: fmt.Errorf("failed to build model: %w", errors.Join(modelErrors...))}
+	}
+	if doc == nil {
+		return nil, &LoadError{Stage: StageModel, Err: fmt.Errorf("failed to build model")}
+	}
+
+	// Resolve model references
+	resolvingErrors := doc.Index.GetResolver().Resolve()
+	errs := []error{}
+	for i := range resolvingErrors {
+		errs = append(errs, resolvingErrors[i].ErrorRef)
+	}
+	if len(resolvingErrors) > 0 {
+		return nil, &LoadError{Stage: StageResolve, Err: fmt.Errorf("failed to resolve model references: %w", errors.Join(errs...))}
+	}
+
+	return &Document{
+		Model:         doc,
+		Digest:        spec.Digest,
+		Size:          spec.Size,
+		FetchDuration: fetchDuration,
+	}, nil
+}
+
+// Generated are the CRDs generated for a Definition.
+type Generated struct {
+	// Resource is the CRD of the managed resource.
+	Resource *apiextensionsv1.CustomResourceDefinition
+	// Auth are the CRDs of the authentication methods.
+	Auth []*apiextensionsv1.CustomResourceDefinition
+	// Results of the generations, reporting their warnings.
+	Results []crdgen.Result
+}
+
+// GenerateCRDs generates the CRDs of the resource and of its authentication
+// methods, served at the version requested by the Definition, without
+// installing them. The log function, if any, receives the errors of the
+// schemas skipped by the generation.
+func GenerateCRDs(ctx context.Context, doc *libopenapi.DocumentModel[v3.Document], cr *definitionv1alpha1.Definition, log func(msg string, keysAndValues ...any)) (*Generated, error) {
+	if log == nil {
+		log = func(string, ...any) {}
+	}
+
+	err, errors := generator.GenerateByteSchemas(doc, cr.Spec.Resource, cr.Spec.Resource.Identifier)
+	if err != nil {
+		return nil, fmt.Errorf("generating byte schemas: %w", err)
+	}
+	for _, er := range errors {
+		log("Generating Byte Schemas", "Error:", er)
+	}
+
+	version := resourceVersion(cr)
+	res := &Generated{}
+
+	resource := crdgen.Generate(ctx, crdgen.Options{
+		Managed: true,
+		WorkDir: fmt.Sprintf("gen-crds/%s", cr.Spec.Resource.Kind),
+		GVK: schema.GroupVersionKind{
+			Group:   cr.Spec.ResourceGroup,
+			Version: version,
+			Kind:    text.CapitaliseFirstLetter(cr.Spec.Resource.Kind),
+		},
+		Categories:             []string{strings.ToLower(cr.Spec.Resource.Kind)},
+		Plural:                 text.Plural(cr.Spec.Resource.Kind, cr.Spec.Resource.Plural),
+		Singular:               cr.Spec.Resource.Singular,
+		ShortNames:             cr.Spec.Resource.ShortNames,
+		PrinterColumns:         printerColumns(cr.Spec.Resource),
+		MaxRecursionDepth:      cr.Spec.Resource.MaxRecursionDepth,
+		Scope:                  string(cr.Spec.Resource.Scope),
+		SpecJsonSchemaGetter:   generator.OASSpecJsonSchemaGetter(),
+		StatusJsonSchemaGetter: generator.OASStatusJsonSchemaGetter(),
+	})
+	if resource.Err != nil {
+		return nil, fmt.Errorf("generating CRD: %w", resource.Err)
+	}
+	res.Results = append(res.Results, resource)
+
+	res.Resource, err = crds.UnmarshalCRD(resource.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling CRD: %w", err)
+	}
+	labelCRD(cr, res.Resource)
+
+	for secSchemaPair := doc.Model.Components.SecuritySchemes.First(); secSchemaPair != nil; secSchemaPair = secSchemaPair.Next() {
+		authSchemaName, err := generation.GenerateAuthSchemaName(secSchemaPair.Value())
+		if err != nil {
+			log("Generating Auth Schema Name", "Error:", err)
+			continue
+		}
+		resource = crdgen.Generate(ctx, crdgen.Options{
+			Managed: false,
+			WorkDir: fmt.Sprintf("gen-crds/%s", authSchemaName),
+			GVK: schema.GroupVersionKind{
+				Group:   cr.Spec.ResourceGroup,
+				Version: version,
+				Kind:    text.CapitaliseFirstLetter(authSchemaName),
+			},
+			Categories:             []string{strings.ToLower(cr.Spec.Resource.Kind)},
+			SpecJsonSchemaGetter:   generator.OASAuthJsonSchemaGetter(authSchemaName),
+			StatusJsonSchemaGetter: generator.StaticJsonSchemaGetter(),
+			MaxRecursionDepth:      cr.Spec.Resource.MaxRecursionDepth,
+		})
+		if resource.Err != nil {
+			return nil, fmt.Errorf("generating CRD: %w", resource.Err)
+		}
+		res.Results = append(res.Results, resource)
+
+		crd, err := crds.UnmarshalCRD(resource.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling CRD: %w", err)
+		}
+		labelCRD(cr, crd)
+		crd.Labels[deployment.LabelKeyAuthentication] = "true"
+		res.Auth = append(res.Auth, crd)
+	}
+
+	return res, nil
+}
+
+// ControllerOptions returns the options deploying the controller of the
+// resources generated for the Definition from doc.
+func ControllerOptions(doc *libopenapi.DocumentModel[v3.Document], cr *definitionv1alpha1.Definition) deployment.DeployOptions {
+	return deployment.DeployOptions{
+		NamespacedName: types.NamespacedName{
+			Namespace: cr.Namespace,
+			Name:      cr.Name,
+		},
+		Spec:            &cr.Spec,
+		ResourceVersion: resourceVersion(cr),
+		AuthKinds:       authKinds(doc),
+	}
+}
+
+// authKinds returns the kinds of the CRDs generated for the
+// authentication methods of the swagger file.
+func authKinds(doc *libopenapi.DocumentModel[v3.Document]) []string {
+	res := []string{}
+	for secSchemaPair := doc.Model.Components.SecuritySchemes.First(); secSchemaPair != nil; secSchemaPair = secSchemaPair.Next() {
+		authSchemaName, err := generation.GenerateAuthSchemaName(secSchemaPair.Value())
+		if err != nil {
+			continue
+		}
+		res = append(res, text.CapitaliseFirstLetter(authSchemaName))
+	}
+	return res
+}
@@ -0,0 +1,18 @@
+package definition
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckWorkspace(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	if err := CheckWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	if err := CheckWorkspace(); err == nil {
+		t.Error("expected a missing workspace to fail the check")
+	}
+}
@@ -0,0 +1,160 @@
+package definition
+
+import (
+	"errors"
+	"time"
+
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/crds"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
+)
+
+// Results of a CRD install, as counted by crdInstalls.
+const (
+	installResultInstalled = "installed"
+	// installResultHeld is a CRD left as is by the breaking changes policy.
+	installResultHeld = "held"
+	// installResultBlocked is a CRD update refused because it would make the
+	// stored objects unreadable.
+	installResultBlocked = "blocked"
+	installResultFailed  = "failed"
+)
+
+// definitionLabels identify the Definition a metric refers to.
+var definitionLabels = []string{"namespace", "name", "group"}
+
+var (
+	specFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "swaggergen_spec_fetch_duration_seconds",
+		Help:    "Time spent fetching the swagger file of a Definition and the files it references.",
+		Buckets: prometheus.DefBuckets,
+	}, definitionLabels)
+
+	specFetchBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "swaggergen_spec_fetch_bytes",
+		Help:    "Size of the swagger file of a Definition and of the files it references.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+	}, definitionLabels)
+
+	specFetchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "swaggergen_spec_fetch_failures_total",
+		Help: "Failures fetching the swagger file of a Definition, by reason.",
+	}, append(definitionLabels, "reason"))
+
+	specLoadErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "swaggergen_spec_load_errors_total",
+		Help: "Errors parsing the swagger file of a Definition or resolving its references, by stage.",
+	}, append(definitionLabels, "stage"))
+
+	schemaGenerationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "swaggergen_schema_generation_duration_seconds",
+		Help:    "Time spent generating the CRDs of a Definition.",
+		Buckets: prometheus.DefBuckets,
+	}, definitionLabels)
+
+	crdInstalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "swaggergen_crd_installs_total",
+		Help: "Installs of the CRDs generated for a Definition, by result.",
+	}, append(definitionLabels, "result"))
+
+	generatedKinds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swaggergen_generated_kinds",
+		Help: "Number of kinds generated for a Definition, the resource and its authentication methods.",
+	}, definitionLabels)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		specFetchDuration,
+		specFetchBytes,
+		specFetchFailures,
+		specLoadErrors,
+		schemaGenerationDuration,
+		crdInstalls,
+		generatedKinds,
+	)
+}
+
+func metricLabels(cr *definitionv1alpha1.Definition) prometheus.Labels {
+	return prometheus.Labels{
+		"namespace": cr.Namespace,
+		"name":      cr.Name,
+		"group":     cr.Spec.ResourceGroup,
+	}
+}
+
+func withLabel(labels prometheus.Labels, key, value string) prometheus.Labels {
+	res := prometheus.Labels{key: value}
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
+
+// observeLoad records the outcome of loading the swagger file of the
+// Definition.
+func observeLoad(cr *definitionv1alpha1.Definition, doc *Document, err error) {
+	labels := metricLabels(cr)
+	if err == nil {
+		specFetchDuration.With(labels).Observe(doc.FetchDuration.Seconds())
+		specFetchBytes.With(labels).Observe(float64(doc.Size))
+		return
+	}
+
+	var loadErr *LoadError
+	if errors.As(err, &loadErr) {
+		specLoadErrors.With(withLabel(labels, "stage", loadErr.Stage)).Inc()
+		return
+	}
+	reason := specfetch.ErrorReason(err)
+	specFetchFailures.With(withLabel(labels, "reason", string(reason))).Inc()
+}
+
+// observeGeneration records the outcome of generating the CRDs of the
+// Definition, started at start.
+func observeGeneration(cr *definitionv1alpha1.Definition, gen *Generated, start time.Time) {
+	labels := metricLabels(cr)
+	schemaGenerationDuration.With(labels).Observe(time.Since(start).Seconds())
+	if gen != nil {
+		generatedKinds.With(labels).Set(float64(1 + len(gen.Auth)))
+	}
+}
+
+// observeInstall records the outcome of installing a CRD of the Definition;
+// held reports whether the breaking changes policy left the CRD as is.
+func observeInstall(cr *definitionv1alpha1.Definition, held bool, err error) {
+	result := installResultInstalled
+	var incompatible *crds.IncompatibleError
+	switch {
+	case held:
+		result = installResultHeld
+	case errors.As(err, &incompatible):
+		result = installResultBlocked
+	case err != nil:
+		result = installResultFailed
+	}
+	crdInstalls.With(withLabel(metricLabels(cr), "result", result)).Inc()
+}
+
+// forgetMetrics removes the metrics of the deleted Definition. Nothing is
+// observed for a Definition being deleted, so that they are not recreated
+// until its finalizer is removed.
+func forgetMetrics(cr *definitionv1alpha1.Definition) {
+	labels := metricLabels(cr)
+	for _, el := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{
+		specFetchDuration,
+		specFetchBytes,
+		specFetchFailures,
+		specLoadErrors,
+		schemaGenerationDuration,
+		crdInstalls,
+		generatedKinds,
+	} {
+		el.DeletePartialMatch(labels)
+	}
+}
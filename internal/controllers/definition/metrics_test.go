@@ -0,0 +1,110 @@
+package definition
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/provider-runtime/pkg/logging"
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/crds"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
+)
+
+func TestMetrics(t *testing.T) {
+	cr := &definitionv1alpha1.Definition{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "metrics-def"},
+		Spec:       definitionv1alpha1.DefinitionSpec{ResourceGroup: "github.com"},
+	}
+	labels := metricLabels(cr)
+
+	observeLoad(cr, &Document{Size: 2048, FetchDuration: time.Second}, nil)
+	observeLoad(cr, nil, fmt.Errorf("failed to download file: %w",
+		&specfetch.Error{Reason: specfetch.ReasonNotAllowed, Err: fmt.Errorf("host not allowed")}))
+	observeLoad(cr, nil, &LoadError{Stage: StageResolve, Err: fmt.Errorf("missing ref")})
+	observeGeneration(cr, &Generated{Auth: make([]*apiextensionsv1.CustomResourceDefinition, 2)}, time.Now())
+	observeInstall(cr, false, nil)
+
+	if got := testutil.CollectAndCount(specFetchDuration); got != 1 {
+		t.Errorf("expected 1 fetch duration series, got %d", got)
+	}
+	if got := testutil.ToFloat64(specFetchFailures.With(withLabel(labels, "reason", string(specfetch.ReasonNotAllowed)))); got != 1 {
+		t.Errorf("expected 1 fetch failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(specLoadErrors.With(withLabel(labels, "stage", StageResolve))); got != 1 {
+		t.Errorf("expected 1 resolve error, got %v", got)
+	}
+	if got := testutil.ToFloat64(generatedKinds.With(labels)); got != 3 {
+		t.Errorf("expected 3 generated kinds, got %v", got)
+	}
+	if got := testutil.ToFloat64(crdInstalls.With(withLabel(labels, "result", installResultInstalled))); got != 1 {
+		t.Errorf("expected 1 install, got %v", got)
+	}
+
+	forgetMetrics(cr)
+	if got := testutil.CollectAndCount(crdInstalls); got != 0 {
+		t.Errorf("expected the installs to be forgotten, got %d series", got)
+	}
+}
+
+func TestObserveInstall(t *testing.T) {
+	incompatible := fmt.Errorf("installing CRD: %w", &crds.IncompatibleError{Name: "repoes.github.com"})
+
+	tests := []struct {
+		name string
+		held bool
+		err  error
+		want string
+	}{
+		{name: "installed", want: installResultInstalled},
+		{name: "held compatible", held: true, want: installResultHeld},
+		{name: "held incompatible", held: true, err: incompatible, want: installResultHeld},
+		{name: "blocked", err: incompatible, want: installResultBlocked},
+		{name: "failed", err: fmt.Errorf("connection refused"), want: installResultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &definitionv1alpha1.Definition{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: tt.name},
+				Spec:       definitionv1alpha1.DefinitionSpec{ResourceGroup: "github.com"},
+			}
+			defer forgetMetrics(cr)
+
+			observeInstall(cr, tt.held, tt.err)
+			for _, result := range []string{installResultInstalled, installResultHeld, installResultBlocked, installResultFailed} {
+				want := 0.0
+				if result == tt.want {
+					want = 1
+				}
+				if got := testutil.ToFloat64(crdInstalls.With(withLabel(metricLabels(cr), "result", result))); got != want {
+					t.Errorf("expected %v %s installs, got %v", want, result, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectDeletedDefinition(t *testing.T) {
+	now := metav1.Now()
+	cr := &definitionv1alpha1.Definition{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "deleted-def", DeletionTimestamp: &now},
+		Spec: definitionv1alpha1.DefinitionSpec{
+			ResourceGroup: "github.com",
+			SwaggerPath:   filepath.Join(t.TempDir(), "missing.yaml"),
+		},
+	}
+
+	c := &connector{log: logging.NewNopLogger()}
+	if _, err := c.Connect(context.TODO(), cr); err == nil {
+		t.Fatal("expected the missing swagger file to fail the connection")
+	}
+	if got := specFetchFailures.DeletePartialMatch(metricLabels(cr)); got != 0 {
+		t.Errorf("expected no fetch failure series for a deleted Definition, got %d", got)
+	}
+}
@@ -0,0 +1,189 @@
+package definition
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/avast/retry-go"
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/crds"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/deployment"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/code"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/schemadiff"
+)
+
+// previewKeySchemaChanges is the key of the schema changes in the preview
+// ConfigMap, next to the manifests of the CRDs keyed by file name.
+const previewKeySchemaChanges = "schema-changes"
+
+// preview is the content of the preview ConfigMap.
+type preview struct {
+	// Data maps the file name of each generated CRD to its manifest, and
+	// previewKeySchemaChanges to the changes to the installed CRDs.
+	Data map[string]string
+	// Digest of the manifests, approving it installs them.
+	Digest string
+	// Report are the schema changes of the CRD of the managed resource.
+	Report schemadiff.Report
+}
+
+// buildPreview returns the preview of the generated CRDs: their manifests
+// and their schema changes with respect to the installed ones.
+func buildPreview(ctx context.Context, kube client.Client, gen *Generated) (*preview, error) {
+	res := &preview{Data: map[string]string{}}
+	changes := []string{}
+
+	h := sha256.New()
+	for i, crd := range append([]*apiextensionsv1.CustomResourceDefinition{gen.Resource}, gen.Auth...) {
+		dat, err := code.MarshalCRD(crd)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling CRD '%s': %w", crd.Name, err)
+		}
+		key := fmt.Sprintf("%s.yaml", crd.Name)
+		res.Data[key] = string(dat)
+		h.Write([]byte(key))
+		h.Write(dat)
+
+		cur, err := crds.GetCRD(ctx, kube, crd.Name)
+		if err != nil {
+			return nil, err
+		}
+		if cur == nil {
+			changes = append(changes, fmt.Sprintf("%s: new CRD", crd.Name))
+			continue
+		}
+
+		report := schemadiff.CompareCRDs(cur, crds.MergeVersions(cur, crd))
+		if i == 0 {
+			res.Report = report
+		}
+		if len(report.Changes) == 0 {
+			changes = append(changes, fmt.Sprintf("%s: no changes", crd.Name))
+		}
+		for _, el := range report.Changes {
+			changes = append(changes, fmt.Sprintf("%s: %s", crd.Name, el))
+		}
+	}
+
+	res.Data[previewKeySchemaChanges] = strings.Join(changes, "\n") + "\n"
+	res.Digest = fmt.Sprintf("%x", h.Sum(nil))
+	return res, nil
+}
+
+// previewName returns the name of the ConfigMap holding the preview of the
+// CRDs of the Definition.
+func previewName(cr *definitionv1alpha1.Definition) string {
+	return fmt.Sprintf("%s-preview", cr.Name)
+}
+
+// previewPending reports whether the preview of the current Definition
+// is waiting for approval.
+func previewPending(cr *definitionv1alpha1.Definition, digest string) bool {
+	p := cr.Status.Preview
+	return previewCurrent(cr, digest) && !p.Installed &&
+		cr.GetAnnotations()[definitionv1alpha1.AnnotationKeyApprovedPreview] != p.Digest
+}
+
+// previewCurrent reports whether the preview in the status has been
+// generated from the current Definition and swagger file.
+func previewCurrent(cr *definitionv1alpha1.Definition, digest string) bool {
+	p := cr.Status.Preview
+	return p != nil && p.ObservedGeneration == cr.Generation && p.SourceDigest == digest
+}
+
+// writePreview writes the preview of the generated CRDs to the preview
+// ConfigMap and reports whether it has been approved.
+func (e *external) writePreview(ctx context.Context, cr *definitionv1alpha1.Definition, gen *Generated) (bool, error) {
+	p, err := buildPreview(ctx, e.kube, gen)
+	if err != nil {
+		return false, fmt.Errorf("building preview: %w", err)
+	}
+
+	cm := corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      previewName(cr),
+			Namespace: cr.Namespace,
+			Labels: deployment.DefinitionLabels(types.NamespacedName{
+				Namespace: cr.Namespace,
+				Name:      cr.Name,
+			}),
+			OwnerReferences: []metav1.OwnerReference{deployment.OwnerReference(cr)},
+		},
+		Data: p.Data,
+	}
+	err = installConfigMap(ctx, e.kube, &cm)
+	if err != nil {
+		return false, fmt.Errorf("installing preview ConfigMap: %w", err)
+	}
+
+	cr.Status.Preview = &definitionv1alpha1.PreviewStatus{
+		ConfigMap:          cm.Name,
+		Digest:             p.Digest,
+		ObservedGeneration: cr.Generation,
+		SourceDigest:       e.digest,
+	}
+
+	approved := cr.GetAnnotations()[definitionv1alpha1.AnnotationKeyApprovedPreview] == p.Digest
+	if !approved {
+		cr.Status.SchemaChanges = schemaChangesStatus(p.Report, false)
+		e.log.Debug("CRDs previewed", "configmap", cm.Name, "digest", p.Digest)
+		e.rec.Eventf(cr, corev1.EventTypeNormal, "PreviewReady",
+			"CRDs previewed in ConfigMap '%s', annotate the Definition with %s=%s to install them",
+			cm.Name, definitionv1alpha1.AnnotationKeyApprovedPreview, p.Digest)
+	}
+	return approved, nil
+}
+
+// removePreview deletes the preview ConfigMap, if any, and forgets about it.
+func (e *external) removePreview(ctx context.Context, cr *definitionv1alpha1.Definition) error {
+	if cr.Status.Preview == nil {
+		return nil
+	}
+
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Status.Preview.ConfigMap,
+			Namespace: cr.Namespace,
+		},
+	}
+	err := e.kube.Delete(ctx, &cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting preview ConfigMap: %w", err)
+	}
+
+	cr.Status.Preview = nil
+	return nil
+}
+
+func installConfigMap(ctx context.Context, kube client.Client, obj *corev1.ConfigMap) error {
+	return retry.Do(
+		func() error {
+			tmp := &corev1.ConfigMap{}
+			err := kube.Get(ctx, client.ObjectKeyFromObject(obj), tmp)
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					return kube.Create(ctx, obj.DeepCopy())
+				}
+
+				return err
+			}
+
+			upd := obj.DeepCopy()
+			upd.SetResourceVersion(tmp.GetResourceVersion())
+			return kube.Update(ctx, upd)
+		},
+	)
+}
@@ -0,0 +1,123 @@
+package definition
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	definitionv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testCRD(name string, props map[string]apiextensionsv1.JSONSchemaProps) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "github.com",
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1alpha1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {Type: "object", Properties: props},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildPreview(t *testing.T) {
+	installed := testCRD("repoes.github.com", map[string]apiextensionsv1.JSONSchemaProps{
+		"name":    {Type: "string"},
+		"private": {Type: "boolean"},
+	})
+
+	scheme := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	kube := fake.NewClientBuilder().WithScheme(scheme).WithObjects(installed).Build()
+
+	gen := &Generated{
+		Resource: testCRD("repoes.github.com", map[string]apiextensionsv1.JSONSchemaProps{
+			"name": {Type: "string"},
+		}),
+		Auth: []*apiextensionsv1.CustomResourceDefinition{
+			testCRD("bearerauths.github.com", map[string]apiextensionsv1.JSONSchemaProps{
+				"tokenRef": {Type: "object"},
+			}),
+		},
+	}
+
+	res, err := buildPreview(context.TODO(), kube, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"repoes.github.com.yaml", "bearerauths.github.com.yaml", previewKeySchemaChanges} {
+		if len(res.Data[key]) == 0 {
+			t.Errorf("expected %s in the preview, got keys %v", key, res.Data)
+		}
+	}
+	changes := res.Data[previewKeySchemaChanges]
+	if !strings.Contains(changes, "bearerauths.github.com: new CRD") || !strings.Contains(changes, "private") {
+		t.Errorf("unexpected schema changes:\n%s", changes)
+	}
+	if len(res.Report.Changes) != 1 {
+		t.Errorf("expected the removed field in the report, got %v", res.Report.Changes)
+	}
+
+	again, err := buildPreview(context.TODO(), kube, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Digest != res.Digest {
+		t.Error("expected the digest to be stable")
+	}
+}
+
+func TestPreviewPending(t *testing.T) {
+	cr := &definitionv1alpha1.Definition{
+		ObjectMeta: metav1.ObjectMeta{Name: "repo-def", Generation: 2},
+		Status: definitionv1alpha1.DefinitionStatus{
+			Preview: &definitionv1alpha1.PreviewStatus{
+				ConfigMap:          "repo-def-preview",
+				Digest:             "abc",
+				ObservedGeneration: 2,
+				SourceDigest:       "spec",
+			},
+		},
+	}
+
+	if !previewPending(cr, "spec") {
+		t.Error("expected the preview to wait for approval")
+	}
+	if previewPending(cr, "changed") {
+		t.Error("expected a preview of a changed swagger file not to be current")
+	}
+
+	cr.SetAnnotations(map[string]string{definitionv1alpha1.AnnotationKeyApprovedPreview: "old"})
+	if !previewPending(cr, "spec") {
+		t.Error("expected the approval of another preview to be ignored")
+	}
+
+	cr.SetAnnotations(map[string]string{definitionv1alpha1.AnnotationKeyApprovedPreview: "abc"})
+	if previewPending(cr, "spec") {
+		t.Error("expected the approved preview not to wait")
+	}
+}
@@ -0,0 +1,210 @@
+// Package crdgen generates the CRD of a resource from its JSON schemas. It
+// is a port of github.com/krateoplatformops/crdgen v0.3.3, which the
+// definition controller imported as this package, built on the code
+// generator of the provider so that the options the Definitions add, like
+// the printer columns, reach the generated CRDs.
+package crdgen
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/code"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type JsonSchemaGetter interface {
+	Get() ([]byte, error)
+}
+
+// PrinterColumn describes an additional column shown by 'kubectl get'.
+type PrinterColumn = code.PrinterColumn
+
+type Options struct {
+	WorkDir                string
+	GVK                    schema.GroupVersionKind
+	Categories             []string
+	Plural                 string
+	Singular               string
+	ShortNames             []string
+	PrinterColumns         []PrinterColumn
+	SpecJsonSchemaGetter   JsonSchemaGetter
+	StatusJsonSchemaGetter JsonSchemaGetter
+	Managed                bool
+	MaxRecursionDepth      int
+	// Scope is the scope of the resource, Namespaced (the default) or Cluster.
+	Scope string
+	// UseControllerGen generates the CRD running controller-gen on the Go
+	// types, in a temporary module, instead of building it in-process.
+	// It requires a Go toolchain and access to the module proxy.
+	UseControllerGen bool
+}
+
+type Result struct {
+	WorkDir  string
+	Manifest []byte
+	Digest   string
+	GVK      schema.GroupVersionKind
+	// Warnings lists the problems that did not prevent the generation,
+	// such as fields without a schema whose unknown fields are preserved.
+	Warnings []string
+	Err      error
+}
+
+func Generate(ctx context.Context, opts Options) (res Result) {
+	spec, err := opts.SpecJsonSchemaGetter.Get()
+	if err != nil {
+		res.Err = err
+		return
+	}
+
+	res.GVK = opts.GVK
+
+	nfo := code.Resource{
+		Group:          opts.GVK.Group,
+		Version:        opts.GVK.Version,
+		Kind:           opts.GVK.Kind,
+		Schema:         spec,
+		Categories:     opts.Categories,
+		Plural:         opts.Plural,
+		Singular:       opts.Singular,
+		ShortNames:     opts.ShortNames,
+		PrinterColumns: opts.PrinterColumns,
+		IsManaged:      opts.Managed,
+		Scope:          opts.Scope,
+
+		MaxRecursionDepth: opts.MaxRecursionDepth,
+	}
+
+	if opts.StatusJsonSchemaGetter != nil {
+		nfo.StatusSchema, err = opts.StatusJsonSchemaGetter.Get()
+		if err != nil {
+			res.Err = err
+			return
+		}
+	}
+
+	if opts.UseControllerGen {
+		res.WorkDir, res.Manifest, res.Warnings, res.Err = runControllerGen(&nfo, opts.WorkDir)
+	} else {
+		res.Manifest, res.Warnings, res.Err = buildCRD(&nfo)
+	}
+	if res.Err != nil {
+		return
+	}
+
+	h := sha256.New()
+	_, res.Err = h.Write(spec)
+	if len(nfo.StatusSchema) > 0 {
+		_, res.Err = h.Write(nfo.StatusSchema)
+		res.Digest = fmt.Sprintf("%x", h.Sum(nil))
+		return
+	}
+
+	res.Digest = fmt.Sprintf("%x", h.Sum(nil))
+	return
+}
+
+// buildCRD builds the CRD in-process.
+func buildCRD(nfo *code.Resource) ([]byte, []string, error) {
+	crd, warnings, err := code.BuildCRD(nfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dat, err := code.MarshalCRD(crd)
+	return dat, warnings, err
+}
+
+// runControllerGen writes the Go types in a temporary module and runs
+// controller-gen on them.
+func runControllerGen(nfo *code.Resource, workDir string) (string, []byte, []string, error) {
+	cfg, err := defaultCodeGeneratorOptions(workDir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	clean := len(os.Getenv("CRDGEN_CLEAN_WORKDIR")) == 0
+	if clean {
+		defer os.RemoveAll(cfg.Workdir)
+	}
+
+	warnings, err := code.Do(nfo, cfg)
+	if err != nil {
+		return cfg.Workdir, nil, nil, err
+	}
+
+	cmd := exec.Command("go", "mod", "init", cfg.Module)
+	cmd.Dir = cfg.Workdir
+	if err := cmd.Run(); err != nil {
+		return cfg.Workdir, nil, nil, fmt.Errorf("%s: performing 'go mod init' (workdir: %s, module: %s, gvk: %s/%s,%s)",
+			err.Error(), cfg.Workdir, cfg.Module, nfo.Group, nfo.Version, nfo.Kind)
+	}
+
+	cmd = exec.Command("go", "mod", "tidy")
+	cmd.Dir = cfg.Workdir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > 0 {
+			return cfg.Workdir, nil, nil, fmt.Errorf("%s: performing 'go mod tidy' (workdir: %s, module: %s, gvk: %s/%s,%s)",
+				string(out), cfg.Workdir, cfg.Module, nfo.Group, nfo.Version, nfo.Kind)
+		}
+		return cfg.Workdir, nil, nil, fmt.Errorf("%s: performing 'go mod tidy' (workdir: %s, module: %s, gvk: %s/%s,%s)",
+			err.Error(), cfg.Workdir, cfg.Module, nfo.Group, nfo.Version, nfo.Kind)
+	}
+
+	cmd = exec.Command("go",
+		"run",
+		"--tags",
+		"generate",
+		"sigs.k8s.io/controller-tools/cmd/controller-gen",
+		"object:headerFile=./hack/boilerplate.go.txt",
+		"paths=./...", "crd:crdVersions=v1",
+		"output:artifacts:config=./crds",
+	)
+	cmd.Dir = cfg.Workdir
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > 0 {
+			return cfg.Workdir, nil, nil, fmt.Errorf("%s: performing 'go run --tags generate...' (workdir: %s, module: %s, gvk: %s/%s,%s)",
+				string(out), cfg.Workdir, cfg.Module, nfo.Group, nfo.Version, nfo.Kind)
+		}
+		return cfg.Workdir, nil, nil, fmt.Errorf("%s: performing 'go run --tags generate...' (workdir: %s, module: %s, gvk: %s/%s,%s)",
+			err.Error(), cfg.Workdir, cfg.Module, nfo.Group, nfo.Version, nfo.Kind)
+	}
+
+	fsys := os.DirFS(cfg.Workdir)
+	all, err := fs.ReadDir(fsys, "crds")
+	if err != nil {
+		return cfg.Workdir, nil, nil, err
+	}
+
+	fp, err := fsys.Open(filepath.Join("crds", all[0].Name()))
+	if err != nil {
+		return cfg.Workdir, nil, nil, err
+	}
+	defer fp.Close()
+
+	dat, err := io.ReadAll(fp)
+	return cfg.Workdir, dat, warnings, err
+}
+
+func defaultCodeGeneratorOptions(rootDir string) (opts code.Options, err error) {
+	opts.Module = fmt.Sprintf("github.com/krateoplatformops/%s", rootDir)
+	opts.Workdir = filepath.Join(os.TempDir(), opts.Module)
+	err = os.MkdirAll(opts.Workdir, os.ModePerm)
+	if err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
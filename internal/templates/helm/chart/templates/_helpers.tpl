@@ -0,0 +1,13 @@
+{{/*
+The name of the Deployment of the controller.
+*/}}
+{{- define "controller.fullname" -}}
+{{ .Values.gvr.resource }}-{{ .Values.gvr.version }}-controller
+{{- end }}
+
+{{/*
+The name of the cluster scoped objects, unique across the namespaces.
+*/}}
+{{- define "controller.clusterName" -}}
+{{ .Release.Namespace }}-{{ .Values.name }}
+{{- end }}
@@ -0,0 +1,119 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/specfetch"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// maxChartSize bounds the size of a downloaded chart archive.
+const maxChartSize = 20 << 20
+
+var (
+	//go:embed all:chart
+	defaultChartFS embed.FS
+)
+
+// DefaultChart loads the chart embedded in the provider, installing the
+// composition-dynamic-controller of a generated resource.
+func DefaultChart(ctx context.Context) (*Chart, error) {
+	sub, err := fs.Sub(defaultChartFS, "chart")
+	if err != nil {
+		return nil, err
+	}
+	return LoadChart(ctx, sub)
+}
+
+// FetchOptions configures FetchChart.
+type FetchOptions struct {
+	// AllowedHosts are the hosts the download of a chart archive may be
+	// redirected to, besides the host of the chart.
+	AllowedHosts []string
+	// Client is the HTTP client downloading the chart archives.
+	// Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// FetchChart loads the chart at ref: an OCI reference (oci://...) pulled
+// at version or the URL of a chart archive. Local charts are not supported:
+// the reference comes from a Definition, not from the provider.
+func FetchChart(ctx context.Context, ref string, version string, opts FetchOptions) (*Chart, error) {
+	var (
+		dat []byte
+		err error
+	)
+	switch {
+	case registry.IsOCI(ref):
+		dat, err = pullChart(ref, version)
+	case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://"):
+		dat, err = downloadChart(ctx, ref, opts)
+	default:
+		err = fmt.Errorf("unsupported chart reference, expected an OCI reference or an HTTP(S) URL")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch chart '%s': %w", ref, err)
+	}
+
+	chart, err := loader.LoadArchive(bytes.NewReader(dat))
+	if err != nil {
+		return nil, fmt.Errorf("could not load chart '%s': %w", ref, err)
+	}
+
+	return &Chart{c: chart}, nil
+}
+
+func pullChart(ref string, version string) ([]byte, error) {
+	if len(version) == 0 {
+		return nil, fmt.Errorf("the version is required by OCI references")
+	}
+
+	client, err := registry.NewClient(registry.ClientOptEnableCache(false))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Pull(fmt.Sprintf("%s:%s", strings.TrimPrefix(ref, "oci://"), version))
+	if err != nil {
+		return nil, err
+	}
+	return res.Chart.Data, nil
+}
+
+func downloadChart(ctx context.Context, ref string, opts FetchOptions) ([]byte, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := specfetch.Client(opts.Client, req.URL, opts.AllowedHosts).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// a truncated archive would fail to load with a misleading error
+	dat, err := io.ReadAll(io.LimitReader(resp.Body, maxChartSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxChartSize {
+		return nil, fmt.Errorf("chart archive larger than %d bytes", maxChartSize)
+	}
+	return dat, nil
+}
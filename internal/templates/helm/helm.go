@@ -8,11 +8,15 @@ import (
 	"regexp"
 	"strings"
 
-	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
 )
 
+const notesFileSuffix = "NOTES.txt"
+
 // Chart represents a loaded Helm chart.
 type Chart struct {
 	c *chart.Chart
@@ -54,27 +58,57 @@ func (c *TemplateConfig) defaults() error {
 
 // Template will runhelm template in the provided chart and values without the need of the Helm binary
 // and without executing an external command.
+//
+// The chart is rendered by the Helm engine alone, as a client only install
+// would: no API server is contacted, hooks and NOTES.txt are left out.
 func Template(ctx context.Context, config TemplateConfig) (string, error) {
 	err := config.defaults()
 	if err != nil {
 		return "", fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Create chart renderer.
-	client := action.NewInstall(&action.Configuration{})
-	client.ClientOnly = true
-	client.DryRun = true
-	client.ReleaseName = config.ReleaseName
-	client.IncludeCRDs = config.IncludeCRDs
-	client.Namespace = config.Namespace
+	chrt := config.Chart.c
+	if err := chartutil.ProcessDependencies(chrt, config.Values); err != nil {
+		return "", fmt.Errorf("could not process chart dependencies: %w", err)
+	}
+
+	vals, err := chartutil.ToRenderValues(chrt, config.Values, chartutil.ReleaseOptions{
+		Name:      config.ReleaseName,
+		Namespace: config.Namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return "", fmt.Errorf("could not compute chart values: %w", err)
+	}
 
 	// Render chart.
-	rel, err := client.Run(config.Chart.c, config.Values)
+	files, err := engine.Render(chrt, vals)
 	if err != nil {
 		return "", fmt.Errorf("could not render helm chart correctly: %w", err)
 	}
+	for k := range files {
+		if strings.HasSuffix(k, notesFileSuffix) {
+			delete(files, k)
+		}
+	}
+
+	_, sorted, err := releaseutil.SortManifests(files, chartutil.DefaultCapabilities.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return "", fmt.Errorf("could not sort rendered manifests: %w", err)
+	}
+
+	var b bytes.Buffer
+	if config.IncludeCRDs {
+		for _, crd := range chrt.CRDObjects() {
+			fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", crd.Filename, string(crd.File.Data[:]))
+		}
+	}
+	for _, m := range sorted {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", m.Name, m.Content)
+	}
 
-	manifests := rel.Manifest
+	manifests := b.String()
 	if len(config.ShowFiles) > 0 {
 		manifests, err = filterFiles(manifests, config.ShowFiles)
 		if err != nil {
@@ -0,0 +1,181 @@
+package helm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/golden"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+var testValues = map[string]any{
+	"name": "repo-def",
+	"gvr": map[string]any{
+		"group":    "github.com",
+		"version":  "v1alpha1",
+		"resource": "repoes",
+	},
+	"logLevel":  "Debug",
+	"replicas":  2,
+	"extraArgs": []any{"-max-retries=3"},
+	"env": []any{
+		map[string]any{"name": "HTTP_PROXY", "value": "http://proxy:3128"},
+	},
+	"nodeSelector": map[string]any{"kubernetes.io/os": "linux"},
+	"tolerations": []any{
+		map[string]any{"key": "dedicated", "operator": "Equal", "value": "krateo", "effect": "NoSchedule"},
+	},
+	"image": map[string]any{
+		"tag":         "0.5.1",
+		"pullSecrets": []any{"registry-creds"},
+	},
+	"rbac": map[string]any{
+		"rules": []any{
+			map[string]any{
+				"apiGroups": []any{"github.com"},
+				"resources": []any{"repoes"},
+				"verbs":     []any{"get", "list", "watch"},
+			},
+		},
+	},
+}
+
+func TestTemplateDefaultChart(t *testing.T) {
+	chart, err := DefaultChart(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Template(context.TODO(), TemplateConfig{
+		ReleaseName: "repo-def",
+		Namespace:   "demo",
+		Chart:       chart,
+		Values:      testValues,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, filepath.Join("testdata", "default-chart.yaml.golden"), []byte(res))
+}
+
+func TestTemplateShowFiles(t *testing.T) {
+	chart, err := DefaultChart(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Template(context.TODO(), TemplateConfig{
+		ReleaseName: "repo-def",
+		Namespace:   "demo",
+		Chart:       chart,
+		Values:      testValues,
+		ShowFiles:   []string{"templates/serviceaccount.yaml"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(res, "kind: ") != 1 || !strings.Contains(res, "kind: ServiceAccount") {
+		t.Errorf("expected the service account alone, got:\n%s", res)
+	}
+}
+
+func TestFetchChart(t *testing.T) {
+	chart, err := DefaultChart(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := chartutil.Save(chart.c, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/controller.tgz" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, archive)
+	}))
+	defer srv.Close()
+
+	got, err := FetchChart(context.TODO(), srv.URL+"/controller.tgz", "", FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.c.Name() != chart.c.Name() || len(got.c.Templates) != len(chart.c.Templates) {
+		t.Errorf("unexpected chart fetched: %s", got.c.Name())
+	}
+
+	if _, err := FetchChart(context.TODO(), srv.URL+"/missing.tgz", "", FetchOptions{}); err == nil {
+		t.Error("expected an error fetching a missing chart")
+	}
+	if _, err := FetchChart(context.TODO(), "oci://registry.example.com/charts/controller", "", FetchOptions{}); err == nil {
+		t.Error("expected an error pulling an OCI chart without version")
+	}
+	if _, err := FetchChart(context.TODO(), archive, "", FetchOptions{}); err == nil || !strings.Contains(err.Error(), "unsupported chart reference") {
+		t.Errorf("expected a local chart to be refused, got: %v", err)
+	}
+}
+
+func TestFetchChartRedirects(t *testing.T) {
+	chart, err := DefaultChart(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := chartutil.Save(chart.c, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	}))
+	defer dst.Close()
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, dst.URL+"/controller.tgz", http.StatusFound)
+	}))
+	defer src.Close()
+
+	_, err = FetchChart(context.TODO(), src.URL+"/controller.tgz", "", FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("expected the redirect to be refused, got: %v", err)
+	}
+
+	dstURL, err := url.Parse(dst.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FetchChart(context.TODO(), src.URL+"/controller.tgz", "", FetchOptions{
+		AllowedHosts: []string{dstURL.Host},
+	})
+	if err != nil {
+		t.Fatalf("expected the redirect to an allowed host to be followed, got: %v", err)
+	}
+}
+
+func TestFetchChartTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, io.LimitReader(zeros{}, maxChartSize+1))
+	}))
+	defer srv.Close()
+
+	_, err := FetchChart(context.TODO(), srv.URL+"/controller.tgz", "", FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "chart archive larger than") {
+		t.Fatalf("expected a chart too large error, got: %v", err)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -4,15 +4,34 @@ import (
 	"fmt"
 	"strings"
 	ttemplate "text/template"
+
+	"sigs.k8s.io/yaml"
 )
 
 // TxtFuncMap returns a 'text/template'.FuncMap
 func TxtFuncMap() ttemplate.FuncMap {
 	return ttemplate.FuncMap(map[string]any{
-		"quote": quote,
+		"quote":  quote,
+		"toYaml": toYaml,
+		"indent": indent,
 	})
 }
 
+// toYaml marshals v, without the trailing newline.
+func toYaml(v any) (string, error) {
+	dat, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(dat), "\n"), nil
+}
+
+// indent prefixes each line of str with n spaces.
+func indent(n int, str string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(str, "\n", "\n"+pad)
+}
+
 func quote(str ...any) string {
 	out := make([]string, 0, len(str))
 	for _, s := range str {
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"strings"
 	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 var (
@@ -12,17 +15,35 @@ var (
 	deploymentTpl string
 )
 
+const (
+	// DefaultImage is the repository of the controller image.
+	DefaultImage = "ghcr.io/matteogastaldello/composition-dynamic-controller"
+	// DefaultTag is the tag of the controller image.
+	DefaultTag = "latest"
+)
+
 type Renderoptions struct {
 	Group      string
 	Version    string
 	Resource   string
 	Namespace  string
 	Name       string
+	Image      string
 	Tag        string
 	ClientType string
+	// LogLevel enables the debug logs of the controller when set to Debug.
+	LogLevel         string
+	ImagePullSecrets []string
+	Replicas         *int32
+	Resources        *corev1.ResourceRequirements
+	NodeSelector     map[string]string
+	Tolerations      []corev1.Toleration
+	Affinity         *corev1.Affinity
+	ExtraArgs        []string
+	Env              []corev1.EnvVar
 }
 
-func Values(opts Renderoptions) map[string]string {
+func Values(opts Renderoptions) map[string]any {
 	if len(opts.Name) == 0 {
 		opts.Name = fmt.Sprintf("%s-controller", opts.Resource)
 	}
@@ -31,18 +52,41 @@ func Values(opts Renderoptions) map[string]string {
 		opts.Namespace = "default"
 	}
 
-	return map[string]string{
-		"apiGroup":   opts.Group,
-		"apiVersion": opts.Version,
-		"resource":   opts.Resource,
-		"name":       opts.Name,
-		"namespace":  opts.Namespace,
-		"tag":        opts.Tag,
-		"clientType": opts.ClientType,
+	if len(opts.Image) == 0 {
+		opts.Image = DefaultImage
+	}
+
+	if len(opts.Tag) == 0 {
+		opts.Tag = DefaultTag
+	}
+
+	replicas := int32(1)
+	if opts.Replicas != nil {
+		replicas = *opts.Replicas
+	}
+
+	return map[string]any{
+		"apiGroup":         opts.Group,
+		"apiVersion":       opts.Version,
+		"resource":         opts.Resource,
+		"name":             opts.Name,
+		"namespace":        opts.Namespace,
+		"image":            opts.Image,
+		"tag":              opts.Tag,
+		"clientType":       opts.ClientType,
+		"debug":            strings.EqualFold(opts.LogLevel, "Debug"),
+		"imagePullSecrets": opts.ImagePullSecrets,
+		"replicas":         replicas,
+		"resources":        opts.Resources,
+		"nodeSelector":     opts.NodeSelector,
+		"tolerations":      opts.Tolerations,
+		"affinity":         opts.Affinity,
+		"extraArgs":        opts.ExtraArgs,
+		"env":              opts.Env,
 	}
 }
 
-func RenderDeployment(values map[string]string) ([]byte, error) {
+func RenderDeployment(values map[string]any) ([]byte, error) {
 	tpl, err := template.New("deployment").Funcs(TxtFuncMap()).Parse(deploymentTpl)
 	if err != nil {
 		return nil, err
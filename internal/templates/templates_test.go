@@ -3,7 +3,15 @@ package templates
 import (
 	_ "embed"
 	"fmt"
+	"path/filepath"
 	"testing"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/golden"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
 )
 
 func TestDeploymentManifest(t *testing.T) {
@@ -21,3 +29,103 @@ func TestDeploymentManifest(t *testing.T) {
 
 	fmt.Println(string(bin))
 }
+
+func TestDeploymentManifestProfile(t *testing.T) {
+	values := Values(Renderoptions{
+		Group:            "github.com",
+		Version:          "v1alpha1",
+		Resource:         "repoes",
+		Name:             "repo-def",
+		Namespace:        "demo",
+		Image:            "registry.example.com/cdc",
+		Tag:              "0.5.1",
+		ClientType:       "REST",
+		LogLevel:         "Debug",
+		ImagePullSecrets: []string{"registry-creds"},
+		Replicas:         ptrTo(int32(2)),
+		Resources: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+		NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations: []corev1.Toleration{
+			{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "krateo", Effect: corev1.TaintEffectNoSchedule},
+		},
+		Affinity: &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "node-role", Operator: corev1.NodeSelectorOpIn, Values: []string{"krateo"}},
+						},
+					}},
+				},
+			},
+		},
+		ExtraArgs: []string{"-max-reconcile-rate=3"},
+		Env: []corev1.EnvVar{
+			{Name: "HTTP_PROXY", Value: "http://proxy:3128"},
+			{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "token"},
+					Key:                  "value",
+				},
+			}},
+		},
+	})
+	bin, err := RenderDeployment(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, filepath.Join("testdata", "deployment.yaml.golden"), bin)
+
+	dep := appsv1.Deployment{}
+	if err := yaml.UnmarshalStrict(bin, &dep); err != nil {
+		t.Fatal(err)
+	}
+	if got := dep.Spec.Template.Spec.Containers[0].Resources.Requests.Cpu().String(); got != "100m" {
+		t.Errorf("unexpected cpu request: %s", got)
+	}
+}
+
+func TestDeploymentManifestDefaults(t *testing.T) {
+	bin, err := RenderDeployment(Values(Renderoptions{
+		Group:    "github.com",
+		Version:  "v1alpha1",
+		Resource: "repoes",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dep := appsv1.Deployment{}
+	if err := yaml.UnmarshalStrict(bin, &dep); err != nil {
+		t.Fatal(err)
+	}
+
+	pod := dep.Spec.Template.Spec
+	if got := pod.Containers[0].Image; got != DefaultImage+":"+DefaultTag {
+		t.Errorf("unexpected image: %s", got)
+	}
+	if got := *dep.Spec.Replicas; got != 1 {
+		t.Errorf("unexpected replicas: %d", got)
+	}
+	if len(pod.ImagePullSecrets) > 0 || len(pod.Tolerations) > 0 || pod.Affinity != nil || len(pod.Containers[0].Env) > 0 {
+		t.Errorf("unexpected scheduling or pull settings: %+v", pod)
+	}
+	for _, el := range pod.Containers[0].Args {
+		if el == "-debug" {
+			t.Errorf("unexpected debug flag")
+		}
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
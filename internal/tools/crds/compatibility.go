@@ -0,0 +1,50 @@
+package crds
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/schemadiff"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// IncompatibleError reports why a CRD update has been refused.
+type IncompatibleError struct {
+	Name    string
+	Reasons []string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("update of CRD %s is incompatible with stored objects: %s",
+		e.Name, strings.Join(e.Reasons, "; "))
+}
+
+// CheckCompatibility returns an *IncompatibleError when replacing oldObj
+// with newObj introduces breaking changes (see schemadiff.CompareCRDs):
+// stored versions no longer defined, removed fields, type changes or
+// narrowed enums. A scope change is always refused.
+func CheckCompatibility(oldObj, newObj *apiextensionsv1.CustomResourceDefinition) error {
+	breaking := schemadiff.CompareCRDs(oldObj, newObj).Filter(schemadiff.Breaking)
+
+	reasons := make([]string, 0, len(breaking)+1)
+	if err := checkScope(oldObj, newObj); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+	for _, el := range breaking {
+		reasons = append(reasons, el.String())
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	return &IncompatibleError{Name: newObj.Name, Reasons: reasons}
+}
+
+// checkScope reports the scope change of a CRD, which the API server
+// refuses whatever the schema changes.
+func checkScope(oldObj, newObj *apiextensionsv1.CustomResourceDefinition) error {
+	if len(oldObj.Spec.Scope) == 0 || len(newObj.Spec.Scope) == 0 || oldObj.Spec.Scope == newObj.Spec.Scope {
+		return nil
+	}
+	return fmt.Errorf("scope cannot change from %s to %s", oldObj.Spec.Scope, newObj.Spec.Scope)
+}
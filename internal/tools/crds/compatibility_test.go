@@ -0,0 +1,103 @@
+package crds
+
+import (
+	"errors"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func crdWithSchema(version string, props map[string]apiextensionsv1.JSONSchemaProps) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    version,
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {Type: "object", Properties: props},
+							},
+						},
+					},
+				},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: []string{version},
+		},
+	}
+}
+
+func withScope(obj *apiextensionsv1.CustomResourceDefinition, scope apiextensionsv1.ResourceScope) *apiextensionsv1.CustomResourceDefinition {
+	obj.Spec.Scope = scope
+	return obj
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	oldObj := withScope(crdWithSchema("v1alpha1", map[string]apiextensionsv1.JSONSchemaProps{
+		"name":    {Type: "string"},
+		"private": {Type: "boolean"},
+	}), apiextensionsv1.NamespaceScoped)
+
+	tests := []struct {
+		name    string
+		newObj  *apiextensionsv1.CustomResourceDefinition
+		reasons int
+	}{
+		{
+			name: "additive",
+			newObj: crdWithSchema("v1alpha1", map[string]apiextensionsv1.JSONSchemaProps{
+				"name":        {Type: "string"},
+				"private":     {Type: "boolean"},
+				"description": {Type: "string"},
+			}),
+		},
+		{
+			name: "removed field",
+			newObj: crdWithSchema("v1alpha1", map[string]apiextensionsv1.JSONSchemaProps{
+				"name": {Type: "string"},
+			}),
+			reasons: 1,
+		},
+		{
+			name: "type change in new version",
+			newObj: crdWithSchema("v1beta1", map[string]apiextensionsv1.JSONSchemaProps{
+				"name":    {Type: "string"},
+				"private": {Type: "string"},
+			}),
+			reasons: 2,
+		},
+		{
+			name: "scope change",
+			newObj: withScope(crdWithSchema("v1alpha1", map[string]apiextensionsv1.JSONSchemaProps{
+				"name":    {Type: "string"},
+				"private": {Type: "boolean"},
+			}), apiextensionsv1.ClusterScoped),
+			reasons: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckCompatibility(oldObj, tc.newObj)
+			if tc.reasons == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var incompatible *IncompatibleError
+			if !errors.As(err, &incompatible) {
+				t.Fatalf("expected *IncompatibleError, got %v", err)
+			}
+			if len(incompatible.Reasons) != tc.reasons {
+				t.Errorf("expected %d reasons, got %v", tc.reasons, incompatible.Reasons)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package crds
 
 import (
 	"context"
+	"sort"
 
 	"github.com/avast/retry-go"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -9,10 +10,14 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/version"
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// FieldManager is the field manager used to server-side apply the generated CRDs.
+const FieldManager = "swaggergen-provider"
+
 func UninstallCRD(ctx context.Context, kube client.Client, gr schema.GroupResource) error {
 	return retry.Do(
 		func() error {
@@ -40,27 +45,128 @@ func UninstallCRD(ctx context.Context, kube client.Client, gr schema.GroupResour
 	)
 }
 
+// InstallCRD creates or updates the CRD using server-side apply. Updating an
+// existing CRD keeps serving its previous versions (see MergeVersions) and
+// is refused with an *IncompatibleError when stored objects would not
+// be readable anymore.
 func InstallCRD(ctx context.Context, kube client.Client, obj *apiextensionsv1.CustomResourceDefinition) error {
+	return installCRD(ctx, kube, obj, true)
+}
+
+// ForceInstallCRD is like InstallCRD but applies the CRD even when the update
+// introduces breaking changes.
+func ForceInstallCRD(ctx context.Context, kube client.Client, obj *apiextensionsv1.CustomResourceDefinition) error {
+	return installCRD(ctx, kube, obj, false)
+}
+
+// GetCRD returns the installed CRD named name, or nil if it does not exist.
+func GetCRD(ctx context.Context, kube client.Client, name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	res := apiextensionsv1.CustomResourceDefinition{}
+	err := kube.Get(ctx, client.ObjectKey{Name: name}, &res)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &res, nil
+}
+
+func installCRD(ctx context.Context, kube client.Client, obj *apiextensionsv1.CustomResourceDefinition, check bool) error {
 	return retry.Do(
 		func() error {
+			res := obj
 			tmp := apiextensionsv1.CustomResourceDefinition{}
 			err := kube.Get(ctx, client.ObjectKeyFromObject(obj), &tmp)
 			if err != nil {
-				if apierrors.IsNotFound(err) {
-					return kube.Create(ctx, obj)
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+			} else {
+				res = MergeVersions(&tmp, obj)
+				if check {
+					if err := CheckCompatibility(&tmp, res); err != nil {
+						return retry.Unrecoverable(err)
+					}
+				} else if err := checkScope(&tmp, res); err != nil {
+					return retry.Unrecoverable(&IncompatibleError{Name: res.Name, Reasons: []string{err.Error()}})
 				}
-
-				return err
 			}
 
-			gracePeriod := int64(0)
-			_ = kube.Delete(ctx, &tmp, &client.DeleteOptions{GracePeriodSeconds: &gracePeriod})
-
-			return kube.Create(ctx, obj)
+			return applyCRD(ctx, kube, res)
 		},
+		retry.LastErrorOnly(true),
 	)
 }
 
+func applyCRD(ctx context.Context, kube client.Client, obj *apiextensionsv1.CustomResourceDefinition) error {
+	res := obj.DeepCopy()
+	res.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	res.SetResourceVersion("")
+	res.SetManagedFields(nil)
+	res.Status = apiextensionsv1.CustomResourceDefinitionStatus{}
+
+	return kube.Patch(ctx, res, client.Apply,
+		client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// MergeVersions returns a copy of newObj that also serves the versions of
+// oldObj that newObj does not define, so that the objects stored with a
+// previous version stay readable. The storage version of newObj becomes
+// the only storage version.
+//
+// Objects are converted using the None strategy, which only rewrites their
+// apiVersion: an object is read through the schema of the requested
+// version, whatever the version it is stored with, and the fields that
+// schema does not define are pruned. The schemas of the versions are not
+// checked against each other here: schemadiff.CompareCRDs reports how the new
+// versions differ from the storage version in use, and the breaking changes
+// policy of the Definition decides whether they are applied.
+func MergeVersions(oldObj, newObj *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+	res := newObj.DeepCopy()
+
+	hasStorage := false
+	for _, el := range res.Spec.Versions {
+		hasStorage = hasStorage || el.Storage
+	}
+
+	for _, el := range oldObj.Spec.Versions {
+		if containsVersion(res.Spec.Versions, el.Name) {
+			continue
+		}
+
+		ver := el.DeepCopy()
+		ver.Served = true
+		if hasStorage {
+			ver.Storage = false
+		}
+		hasStorage = hasStorage || ver.Storage
+
+		res.Spec.Versions = append(res.Spec.Versions, *ver)
+	}
+
+	sort.SliceStable(res.Spec.Versions, func(i, j int) bool {
+		return version.CompareKubeAwareVersionStrings(res.Spec.Versions[i].Name, res.Spec.Versions[j].Name) > 0
+	})
+
+	if res.Spec.Conversion == nil {
+		res.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{
+			Strategy: apiextensionsv1.NoneConverter,
+		}
+	}
+
+	return res
+}
+
+func containsVersion(all []apiextensionsv1.CustomResourceDefinitionVersion, name string) bool {
+	for _, el := range all {
+		if el.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func LookupCRD(ctx context.Context, kube client.Client, gvr schema.GroupVersionResource) (bool, error) {
 	res := apiextensionsv1.CustomResourceDefinition{}
 	err := kube.Get(ctx, client.ObjectKey{Name: gvr.GroupResource().String()}, &res, &client.GetOptions{})
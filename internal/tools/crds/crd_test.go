@@ -0,0 +1,77 @@
+package crds
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestMergeVersions(t *testing.T) {
+	oldObj := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true, Storage: true},
+			},
+		},
+	}
+
+	newObj := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+		},
+	}
+
+	res := MergeVersions(oldObj, newObj)
+
+	if len(res.Spec.Versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(res.Spec.Versions))
+	}
+
+	expected := []struct {
+		name    string
+		storage bool
+	}{
+		{name: "v1beta1", storage: true},
+		{name: "v1alpha1", storage: false},
+	}
+	for i, el := range expected {
+		got := res.Spec.Versions[i]
+		if got.Name != el.name {
+			t.Errorf("version %d: expected %s, got %s", i, el.name, got.Name)
+		}
+		if !got.Served {
+			t.Errorf("version %s: expected to be served", got.Name)
+		}
+		if got.Storage != el.storage {
+			t.Errorf("version %s: expected storage=%t, got %t", got.Name, el.storage, got.Storage)
+		}
+	}
+
+	if res.Spec.Conversion == nil || res.Spec.Conversion.Strategy != apiextensionsv1.NoneConverter {
+		t.Errorf("expected None conversion strategy")
+	}
+
+	if len(newObj.Spec.Versions) != 1 {
+		t.Errorf("expected newObj to be left untouched")
+	}
+}
+
+func TestMergeVersionsSameVersion(t *testing.T) {
+	oldObj := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true, Storage: true},
+			},
+		},
+	}
+
+	res := MergeVersions(oldObj, oldObj.DeepCopy())
+	if len(res.Spec.Versions) != 1 {
+		t.Fatalf("expected 1 version, got %d", len(res.Spec.Versions))
+	}
+	if !res.Spec.Versions[0].Storage {
+		t.Errorf("expected v1alpha1 to be the storage version")
+	}
+}
@@ -0,0 +1,421 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/avast/retry-go"
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/matteogastaldello/swaggergen-provider/internal/templates"
+	"github.com/matteogastaldello/swaggergen-provider/internal/templates/helm"
+	"helm.sh/helm/v3/pkg/chartutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChartValues returns the values of the controller chart: the ones computed
+// from the Definition, its profile and the RBAC the controller needs, with
+// the values of the chart spec merged over them.
+func ChartValues(opts DeployOptions) (map[string]any, error) {
+	gvr := opts.gvr()
+	authResources := opts.authResources()
+
+	ro := renderoptions(gvr, opts.NamespacedName, opts.Spec.ControllerProfile)
+	if len(ro.Image) == 0 {
+		ro.Image = templates.DefaultImage
+	}
+	if len(ro.Tag) == 0 {
+		ro.Tag = templates.DefaultTag
+	}
+	replicas := int32(1)
+	if ro.Replicas != nil {
+		replicas = *ro.Replicas
+	}
+
+	role, cr := chartRBAC(opts)
+
+	computed := map[string]any{
+		"name": opts.NamespacedName.Name,
+		"gvr": map[string]any{
+			"group":    gvr.Group,
+			"version":  gvr.Version,
+			"resource": gvr.Resource,
+		},
+		"scope":         opts.scope(),
+		"authResources": sortedSet(authResources),
+		"clientType":    ro.ClientType,
+		"image": map[string]any{
+			"repository":  ro.Image,
+			"tag":         ro.Tag,
+			"pullSecrets": ro.ImagePullSecrets,
+		},
+		"replicas":     replicas,
+		"logLevel":     ro.LogLevel,
+		"resources":    ro.Resources,
+		"nodeSelector": ro.NodeSelector,
+		"tolerations":  ro.Tolerations,
+		"affinity":     ro.Affinity,
+		"extraArgs":    ro.ExtraArgs,
+		"env":          ro.Env,
+		"rbac": map[string]any{
+			"rules":        role.Rules,
+			"clusterRules": cr.Rules,
+		},
+	}
+
+	// the values are handed to the templates as they would be read from a
+	// values file, without the types of the API
+	dat, err := json.Marshal(computed)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal(dat, &values); err != nil {
+		return nil, err
+	}
+
+	spec := opts.Spec.ControllerChart
+	if spec == nil || spec.Values == nil || len(spec.Values.Raw) == 0 {
+		return values, nil
+	}
+
+	custom := map[string]any{}
+	if err := json.Unmarshal(spec.Values.Raw, &custom); err != nil {
+		return nil, fmt.Errorf("invalid chart values: %w", err)
+	}
+	res := chartutil.CoalesceTables(custom, values)
+	// the chart values may tune the controller, not widen what it is granted
+	res["rbac"] = values["rbac"]
+	return res, nil
+}
+
+// chartRBAC returns the Role and the ClusterRole the controller of the
+// Definition is granted.
+func chartRBAC(opts DeployOptions) (rbacv1.Role, rbacv1.ClusterRole) {
+	gvr := opts.gvr()
+	authResources := opts.authResources()
+	return CreateRole(gvr, opts.scope(), authResources, opts.NamespacedName),
+		CreateClusterRole(gvr, opts.scope(), authResources, opts.NamespacedName)
+}
+
+// RenderChart renders the controller chart of the Definition, released with
+// the name of the Definition in its namespace.
+func RenderChart(ctx context.Context, opts DeployOptions) ([]*unstructured.Unstructured, error) {
+	chart, err := loadChart(ctx, opts.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := ChartValues(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := helm.Template(ctx, helm.TemplateConfig{
+		ReleaseName: opts.NamespacedName.Name,
+		Namespace:   opts.NamespacedName.Namespace,
+		Chart:       chart,
+		Values:      values,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeManifest([]byte(manifest))
+}
+
+// DeployChart renders the controller chart of the Definition and applies the
+// rendered objects, then deletes the installed ones not rendered anymore.
+// The chart may only render the objects of the controller, see
+// checkChartObjects, and never updates an object it did not install.
+// It returns the references of the objects it installed.
+func DeployChart(ctx context.Context, opts DeployOptions) ([]definitionsv1alpha1.ControllerObject, error) {
+	objs, err := RenderChart(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render controller chart: %w", err)
+	}
+
+	for _, obj := range objs {
+		namespaced, err := opts.KubeClient.IsObjectNamespaced(obj)
+		if err != nil {
+			return nil, err
+		}
+		if namespaced {
+			if len(obj.GetNamespace()) == 0 {
+				obj.SetNamespace(opts.NamespacedName.Namespace)
+			}
+			// the chart installs the controller of one Definition, it has
+			// nothing to do in the other namespaces
+			if obj.GetNamespace() != opts.NamespacedName.Namespace {
+				return nil, fmt.Errorf("%s '%s' is not in the namespace of the Definition: %s",
+					obj.GetKind(), obj.GetName(), obj.GetNamespace())
+			}
+		} else {
+			obj.SetNamespace("")
+		}
+	}
+	if err := checkChartObjects(opts, objs); err != nil {
+		return nil, err
+	}
+
+	res := make([]definitionsv1alpha1.ControllerObject, 0, len(objs))
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range DefinitionLabels(opts.NamespacedName) {
+			labels[k] = v
+		}
+		obj.SetLabels(labels)
+		setOwner(obj, opts.Owner)
+
+		if err := installObject(ctx, opts.KubeClient, obj, opts.NamespacedName); err != nil {
+			return res, fmt.Errorf("failed to install %s '%s': %w", obj.GetKind(), obj.GetName(), err)
+		}
+		if opts.Log != nil {
+			opts.Log(fmt.Sprintf("%s successfully installed", obj.GetKind()),
+				"name", obj.GetName(), "namespace", obj.GetNamespace())
+		}
+
+		res = append(res, definitionsv1alpha1.ControllerObject{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+
+	stale := []definitionsv1alpha1.ControllerObject{}
+	for _, el := range opts.Installed {
+		if !containsObject(res, el) {
+			stale = append(stale, el)
+		}
+	}
+
+	return res, UndeployChart(ctx, UndeployChartOptions{
+		KubeClient:     opts.KubeClient,
+		NamespacedName: opts.NamespacedName,
+		Objects:        stale,
+		Log:            opts.Log,
+	})
+}
+
+type UndeployChartOptions struct {
+	KubeClient     client.Client
+	NamespacedName types.NamespacedName
+	// Objects are the objects installed by DeployChart.
+	Objects []definitionsv1alpha1.ControllerObject
+	Log     func(msg string, keysAndValues ...any)
+}
+
+// UndeployChart deletes the objects installed by DeployChart, in the
+// reverse order of their installation. The objects without the labels of
+// the Definition have been replaced by someone else and are kept.
+func UndeployChart(ctx context.Context, opts UndeployChartOptions) error {
+	for i := len(opts.Objects) - 1; i >= 0; i-- {
+		el := opts.Objects[i]
+
+		deleted := false
+		err := retry.Do(
+			func() error {
+				obj := &unstructured.Unstructured{}
+				obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(el.APIVersion, el.Kind))
+				err := opts.KubeClient.Get(ctx, client.ObjectKey{Namespace: el.Namespace, Name: el.Name}, obj)
+				if err != nil {
+					if apierrors.IsNotFound(err) {
+						return nil
+					}
+					return err
+				}
+				if !hasDefinitionLabels(obj, opts.NamespacedName) {
+					return nil
+				}
+
+				err = opts.KubeClient.Delete(ctx, obj, &client.DeleteOptions{})
+				if apierrors.IsNotFound(err) {
+					return nil
+				}
+				deleted = err == nil
+				return err
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to uninstall %s '%s': %w", el.Kind, el.Name, err)
+		}
+
+		if deleted && opts.Log != nil {
+			opts.Log(fmt.Sprintf("%s successfully uninstalled", el.Kind),
+				"name", el.Name, "namespace", el.Namespace)
+		}
+	}
+
+	return nil
+}
+
+// loadChart loads the controller chart of the Definition, downloaded from
+// the hosts its specification may be fetched from.
+func loadChart(ctx context.Context, spec *definitionsv1alpha1.DefinitionSpec) (*helm.Chart, error) {
+	chart := spec.ControllerChart
+	if chart == nil || len(chart.URL) == 0 {
+		return helm.DefaultChart(ctx)
+	}
+	return helm.FetchChart(ctx, chart.URL, chart.Version, helm.FetchOptions{
+		AllowedHosts: spec.AllowedHosts,
+	})
+}
+
+// installObject creates obj or updates the object of the Definition nn with
+// the same name.
+func installObject(ctx context.Context, kube client.Client, obj *unstructured.Unstructured, nn types.NamespacedName) error {
+	return retry.Do(
+		func() error {
+			tmp := &unstructured.Unstructured{}
+			tmp.SetGroupVersionKind(obj.GroupVersionKind())
+			err := kube.Get(ctx, client.ObjectKeyFromObject(obj), tmp)
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					return kube.Create(ctx, obj.DeepCopy())
+				}
+
+				return err
+			}
+
+			if !hasDefinitionLabels(tmp, nn) {
+				return retry.Unrecoverable(errors.New("the object exists and has not been installed for the Definition"))
+			}
+
+			upd := obj.DeepCopy()
+			upd.SetResourceVersion(tmp.GetResourceVersion())
+			return kube.Update(ctx, upd)
+		},
+		retry.LastErrorOnly(true),
+	)
+}
+
+// checkChartObjects checks that the chart only renders the objects of the
+// controller: its ServiceAccounts and Deployments, the Roles and the
+// ClusterRole granting what ChartValues computed, and the bindings of those
+// roles to its ServiceAccounts. The cluster scoped objects are named after
+// the Definition, see ClusterObjectName.
+func checkChartObjects(opts DeployOptions, objs []*unstructured.Unstructured) error {
+	role, cr := chartRBAC(opts)
+	clusterName := ClusterObjectName(opts.NamespacedName)
+
+	serviceAccounts := map[string]bool{}
+	roles := map[string]bool{}
+	for _, obj := range objs {
+		switch obj.GroupVersionKind() {
+		case corev1.SchemeGroupVersion.WithKind("ServiceAccount"):
+			serviceAccounts[obj.GetName()] = true
+		case rbacv1.SchemeGroupVersion.WithKind("Role"):
+			roles[obj.GetName()] = true
+		}
+	}
+
+	checkSubjects := func(subjects []rbacv1.Subject) error {
+		for _, el := range subjects {
+			if el.Kind != rbacv1.ServiceAccountKind || el.Namespace != opts.NamespacedName.Namespace || !serviceAccounts[el.Name] {
+				return fmt.Errorf("subject %s '%s/%s' is not a ServiceAccount of the chart", el.Kind, el.Namespace, el.Name)
+			}
+		}
+		return nil
+	}
+
+	for _, obj := range objs {
+		var err error
+		switch obj.GroupVersionKind() {
+		case corev1.SchemeGroupVersion.WithKind("ServiceAccount"):
+		case appsv1.SchemeGroupVersion.WithKind("Deployment"):
+			sa, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "serviceAccountName")
+			if !serviceAccounts[sa] {
+				err = fmt.Errorf("service account '%s' is not a ServiceAccount of the chart", sa)
+			}
+		case rbacv1.SchemeGroupVersion.WithKind("Role"):
+			tmp := rbacv1.Role{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &tmp); err == nil &&
+				!equality.Semantic.DeepEqual(tmp.Rules, role.Rules) {
+				err = errors.New("the rules differ from the ones of the controller")
+			}
+		case rbacv1.SchemeGroupVersion.WithKind("RoleBinding"):
+			tmp := rbacv1.RoleBinding{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &tmp); err == nil {
+				if tmp.RoleRef.APIGroup != rbacv1.GroupName || tmp.RoleRef.Kind != "Role" || !roles[tmp.RoleRef.Name] {
+					err = fmt.Errorf("role %s '%s' is not a Role of the chart", tmp.RoleRef.Kind, tmp.RoleRef.Name)
+				} else {
+					err = checkSubjects(tmp.Subjects)
+				}
+			}
+		case rbacv1.SchemeGroupVersion.WithKind("ClusterRole"):
+			tmp := rbacv1.ClusterRole{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &tmp); err == nil {
+				if tmp.Name != clusterName {
+					err = fmt.Errorf("the name is not '%s'", clusterName)
+				} else if tmp.AggregationRule != nil || !equality.Semantic.DeepEqual(tmp.Rules, cr.Rules) {
+					err = errors.New("the rules differ from the ones of the controller")
+				}
+			}
+		case rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"):
+			tmp := rbacv1.ClusterRoleBinding{}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &tmp); err == nil {
+				if tmp.Name != clusterName {
+					err = fmt.Errorf("the name is not '%s'", clusterName)
+				} else if tmp.RoleRef.APIGroup != rbacv1.GroupName || tmp.RoleRef.Kind != "ClusterRole" || tmp.RoleRef.Name != clusterName {
+					err = fmt.Errorf("role %s '%s' is not the ClusterRole of the chart", tmp.RoleRef.Kind, tmp.RoleRef.Name)
+				} else {
+					err = checkSubjects(tmp.Subjects)
+				}
+			}
+		default:
+			err = errors.New("the kind is not allowed in the controller chart")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s' in controller chart: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+func decodeManifest(dat []byte) ([]*unstructured.Unstructured, error) {
+	res := []*unstructured.Unstructured{}
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(dat), 4096)
+	for {
+		obj := map[string]any{}
+		err := decoder.Decode(&obj)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		res = append(res, &unstructured.Unstructured{Object: obj})
+	}
+}
+
+func containsObject(list []definitionsv1alpha1.ControllerObject, obj definitionsv1alpha1.ControllerObject) bool {
+	for _, el := range list {
+		if el == obj {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,405 @@
+package deployment
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newChartClient(objs ...client.Object) client.Client {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		corev1.SchemeGroupVersion, rbacv1.SchemeGroupVersion, appsv1.SchemeGroupVersion,
+	})
+	for _, gvk := range []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ServiceAccount"),
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		rbacv1.SchemeGroupVersion.WithKind("Role"),
+		rbacv1.SchemeGroupVersion.WithKind("RoleBinding"),
+		appsv1.SchemeGroupVersion.WithKind("Deployment"),
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	for _, gvk := range []schema.GroupVersionKind{
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+		rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+	} {
+		mapper.Add(gvk, meta.RESTScopeRoot)
+	}
+
+	return fake.NewClientBuilder().
+		WithScheme(clientsetscheme.Scheme).
+		WithRESTMapper(mapper).
+		WithObjects(objs...).
+		Build()
+}
+
+func chartDeployOptions(kube client.Client, chart *definitionsv1alpha1.ControllerChart) DeployOptions {
+	return DeployOptions{
+		KubeClient:     kube,
+		NamespacedName: testNamespacedName,
+		Spec: &definitionsv1alpha1.DefinitionSpec{
+			ResourceGroup:   testGVR.Group,
+			Resource:        definitionsv1alpha1.Resource{Kind: "Repo"},
+			ControllerChart: chart,
+		},
+		ResourceVersion: testGVR.Version,
+		AuthKinds:       []string{"BearerAuth"},
+	}
+}
+
+func TestChartValues(t *testing.T) {
+	opts := chartDeployOptions(nil, &definitionsv1alpha1.ControllerChart{
+		Values: &runtime.RawExtension{
+			Raw: []byte(`{"replicas": 3, "image": {"tag": "0.6.0"}}`),
+		},
+	})
+
+	values, err := ChartValues(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := values["replicas"]; got != float64(3) {
+		t.Errorf("expected the replicas of the chart spec, got %v", got)
+	}
+	image := values["image"].(map[string]any)
+	if image["tag"] != "0.6.0" || image["repository"] == "" {
+		t.Errorf("expected the custom tag over the computed image, got %v", image)
+	}
+	gvr := values["gvr"].(map[string]any)
+	if gvr["resource"] != testGVR.Resource || values["name"] != testNamespacedName.Name {
+		t.Errorf("unexpected computed values: %v", values)
+	}
+	if got := values["authResources"].([]any); len(got) != 1 || got[0] != "bearerauths" {
+		t.Errorf("unexpected auth resources: %v", got)
+	}
+	if rules := values["rbac"].(map[string]any)["rules"].([]any); len(rules) == 0 {
+		t.Error("expected the computed role rules")
+	}
+}
+
+func TestChartValuesScope(t *testing.T) {
+	opts := chartDeployOptions(nil, nil)
+	namespaced, err := ChartValues(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Spec.Resource.Scope = definitionsv1alpha1.ClusterScope
+	cluster, err := ChartValues(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespaced["scope"] != string(definitionsv1alpha1.NamespacedScope) || cluster["scope"] != string(definitionsv1alpha1.ClusterScope) {
+		t.Errorf("unexpected scopes: %v, %v", namespaced["scope"], cluster["scope"])
+	}
+	clusterRules := func(values map[string]any) int {
+		return len(values["rbac"].(map[string]any)["clusterRules"].([]any))
+	}
+	if clusterRules(cluster) <= clusterRules(namespaced) {
+		t.Errorf("expected the cluster rules on the resource, got %d and %d", clusterRules(namespaced), clusterRules(cluster))
+	}
+}
+
+func TestChartValuesKeepRBAC(t *testing.T) {
+	opts := chartDeployOptions(nil, &definitionsv1alpha1.ControllerChart{
+		Values: &runtime.RawExtension{
+			Raw: []byte(`{"rbac": {"clusterRules": [{"apiGroups": ["*"], "resources": ["*"], "verbs": ["*"]}]}}`),
+		},
+	})
+
+	values, err := ChartValues(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cr := chartRBAC(opts)
+	rules := values["rbac"].(map[string]any)["clusterRules"].([]any)
+	if len(rules) != len(cr.Rules) {
+		t.Fatalf("expected the computed cluster rules, got %v", rules)
+	}
+	for _, el := range rules {
+		if groups := el.(map[string]any)["apiGroups"].([]any); groups[0] == "*" {
+			t.Errorf("expected the chart values not to grant %v", el)
+		}
+	}
+}
+
+func TestDeployChart(t *testing.T) {
+	// an object installed by a previous revision of the chart
+	stale := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "stale",
+			Namespace: testNamespacedName.Namespace,
+			Labels:    DefinitionLabels(testNamespacedName),
+		},
+	}
+	kube := newChartClient(stale)
+
+	opts := chartDeployOptions(kube, &definitionsv1alpha1.ControllerChart{})
+	opts.Installed = []definitionsv1alpha1.ControllerObject{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: stale.Namespace, Name: stale.Name},
+	}
+
+	objs, err := DeployChart(context.TODO(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 6 {
+		t.Fatalf("expected 6 installed objects, got %d: %v", len(objs), objs)
+	}
+
+	err = kube.Get(context.TODO(), client.ObjectKeyFromObject(stale), &corev1.ConfigMap{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the stale object to be removed, got: %v", err)
+	}
+
+	dep := appsv1.Deployment{}
+	dep.Name, dep.Namespace = DeploymentName(testGVR), testNamespacedName.Namespace
+	exists, _, err := LookupDeployment(context.TODO(), kube, &dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || dep.Spec.Template.Spec.ServiceAccountName != testNamespacedName.Name {
+		t.Fatalf("expected the deployment of the chart, got exists=%t", exists)
+	}
+
+	crole := rbacv1.ClusterRole{}
+	if err := kube.Get(context.TODO(), client.ObjectKey{Name: ClusterObjectName(testNamespacedName)}, &crole); err != nil {
+		t.Fatal(err)
+	}
+	if len(crole.Rules) == 0 {
+		t.Error("expected the computed cluster role rules")
+	}
+
+	// applying again updates the installed objects
+	opts.Spec.ControllerChart.Values = &runtime.RawExtension{Raw: []byte(`{"replicas": 2}`)}
+	opts.Installed = objs
+	objs, err = DeployChart(context.TODO(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kube.Get(context.TODO(), client.ObjectKeyFromObject(&dep), &dep); err != nil {
+		t.Fatal(err)
+	}
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != 2 {
+		t.Errorf("expected the deployment to be updated, got replicas %v", dep.Spec.Replicas)
+	}
+
+	err = UndeployChart(context.TODO(), UndeployChartOptions{
+		KubeClient:     kube,
+		NamespacedName: testNamespacedName,
+		Objects:        objs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, el := range objs {
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(el.APIVersion, el.Kind))
+		err := kube.Get(context.TODO(), client.ObjectKey{Namespace: el.Namespace, Name: el.Name}, obj)
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s '%s' to be removed, got: %v", el.Kind, el.Name, err)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	opts := chartDeployOptions(nil, nil)
+
+	builtin, err := Digest(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Spec.ControllerChart = &definitionsv1alpha1.ControllerChart{}
+	chart, err := Digest(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chart == builtin {
+		t.Error("expected switching to the chart to change the digest")
+	}
+
+	opts.Spec.ControllerChart.Values = &runtime.RawExtension{Raw: []byte(`{"replicas": 2}`)}
+	values, err := Digest(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values == chart {
+		t.Error("expected the chart values to change the digest")
+	}
+
+	opts.AuthKinds = nil
+	noauth, err := Digest(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noauth == values {
+		t.Error("expected the auth kinds to change the digest")
+	}
+}
+
+func TestManifests(t *testing.T) {
+	for _, chart := range []*definitionsv1alpha1.ControllerChart{nil, {}} {
+		objs, err := Manifests(context.TODO(), chartDeployOptions(nil, chart))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objs) != 6 {
+			t.Fatalf("chart %t: expected 6 objects, got %d", chart != nil, len(objs))
+		}
+
+		kinds := map[string]bool{}
+		for _, obj := range objs {
+			kind := obj.GetObjectKind().GroupVersionKind().Kind
+			kinds[kind] = true
+			if got := obj.GetLabels()[LabelKeyDefinitionName]; got != testNamespacedName.Name {
+				t.Errorf("chart %t: expected the definition label on %s, got %q", chart != nil, kind, got)
+			}
+		}
+		if !kinds["Deployment"] || !kinds["ClusterRole"] {
+			t.Errorf("chart %t: unexpected kinds %v", chart != nil, kinds)
+		}
+	}
+}
+
+func TestDeployChartRefusesForeignObjects(t *testing.T) {
+	// a ServiceAccount with the name of the one of the chart
+	foreign := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: testNamespacedName.Name, Namespace: testNamespacedName.Namespace},
+	}
+	kube := newChartClient(foreign)
+
+	_, err := DeployChart(context.TODO(), chartDeployOptions(kube, &definitionsv1alpha1.ControllerChart{}))
+	if err == nil || !strings.Contains(err.Error(), "has not been installed for the Definition") {
+		t.Fatalf("expected the foreign ServiceAccount not to be updated, got: %v", err)
+	}
+
+	err = UndeployChart(context.TODO(), UndeployChartOptions{
+		KubeClient:     kube,
+		NamespacedName: testNamespacedName,
+		Objects: []definitionsv1alpha1.ControllerObject{
+			{APIVersion: "v1", Kind: "ServiceAccount", Namespace: foreign.Namespace, Name: foreign.Name},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kube.Get(context.TODO(), client.ObjectKeyFromObject(foreign), &corev1.ServiceAccount{}); err != nil {
+		t.Errorf("expected the foreign ServiceAccount to be kept, got: %v", err)
+	}
+}
+
+func TestCheckChartObjects(t *testing.T) {
+	opts := chartDeployOptions(nil, nil)
+
+	tests := []struct {
+		name   string
+		mutate func(t *testing.T, obj *unstructured.Unstructured)
+		err    string
+	}{
+		{
+			name: "default chart",
+		},
+		{
+			name: "other kind",
+			mutate: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "ServiceAccount" {
+					return
+				}
+				obj.SetKind("Secret")
+			},
+			err: "the kind is not allowed",
+		},
+		{
+			name: "wider cluster rules",
+			mutate: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "ClusterRole" {
+					return
+				}
+				rules := []any{map[string]any{"apiGroups": []any{"*"}, "resources": []any{"*"}, "verbs": []any{"*"}}}
+				if err := unstructured.SetNestedSlice(obj.Object, rules, "rules"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "the rules differ",
+		},
+		{
+			name: "binding to another cluster role",
+			mutate: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "RoleBinding" {
+					return
+				}
+				if err := unstructured.SetNestedField(obj.Object, "ClusterRole", "roleRef", "kind"); err != nil {
+					t.Fatal(err)
+				}
+				if err := unstructured.SetNestedField(obj.Object, "cluster-admin", "roleRef", "name"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "is not a Role of the chart",
+		},
+		{
+			name: "cluster role of another definition",
+			mutate: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "ClusterRole" {
+					return
+				}
+				obj.SetName("other-" + obj.GetName())
+			},
+			err: "the name is not",
+		},
+		{
+			name: "deployment running as another account",
+			mutate: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "Deployment" {
+					return
+				}
+				if err := unstructured.SetNestedField(obj.Object, "admin", "spec", "template", "spec", "serviceAccountName"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "is not a ServiceAccount of the chart",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			objs, err := RenderChart(context.TODO(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.mutate != nil {
+				for _, obj := range objs {
+					tc.mutate(t, obj)
+				}
+			}
+
+			err = checkChartObjects(opts, objs)
+			if len(tc.err) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected an error containing %q, got: %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package deployment
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/avast/retry-go"
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -24,7 +28,13 @@ func InstallClusterRole(ctx context.Context, kube client.Client, obj *rbacv1.Clu
 				return err
 			}
 
-			return nil
+			// the rules follow the generated kinds
+			changed := mergeMetadata(&tmp, obj)
+			if !changed && equality.Semantic.DeepEqual(tmp.Rules, obj.Rules) {
+				return nil
+			}
+			tmp.Rules = obj.Rules
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
@@ -33,7 +43,7 @@ func UninstallClusterRole(ctx context.Context, opts UninstallOptions) error {
 	return retry.Do(
 		func() error {
 			obj := rbacv1.ClusterRole{}
-			err := opts.KubeClient.Get(ctx, opts.NamespacedName, &obj, &client.GetOptions{})
+			err := opts.KubeClient.Get(ctx, client.ObjectKey{Name: ClusterObjectName(opts.NamespacedName)}, &obj, &client.GetOptions{})
 			if err != nil {
 				if apierrors.IsNotFound(err) {
 					return nil
@@ -41,6 +51,10 @@ func UninstallClusterRole(ctx context.Context, opts UninstallOptions) error {
 
 				return err
 			}
+			// an object with the same name deployed by someone else
+			if !hasDefinitionLabels(&obj, opts.NamespacedName) {
+				return nil
+			}
 
 			err = opts.KubeClient.Delete(ctx, &obj, &client.DeleteOptions{})
 			if err != nil {
@@ -61,26 +75,45 @@ func UninstallClusterRole(ctx context.Context, opts UninstallOptions) error {
 	)
 }
 
-func CreateClusterRole(opts types.NamespacedName) rbacv1.ClusterRole {
+// CreateClusterRole returns the ClusterRole of the controller of gvr. It
+// grants to read the CRDs of the resource and of the authentication
+// resources, by name, and, when the resource is cluster scoped, the rules
+// on the resource; the authentication resources and the Secrets are only
+// read in the namespace of the Definition, through its Role.
+func CreateClusterRole(gvr schema.GroupVersionResource, scope definitionsv1alpha1.ResourceScope, authResources []string, opts types.NamespacedName) rbacv1.ClusterRole {
+	names := []string{gvr.GroupResource().String()}
+	for _, el := range sortedSet(authResources) {
+		names = append(names, schema.GroupResource{Group: gvr.Group, Resource: el}.String())
+	}
+
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups:     []string{"apiextensions.k8s.io"},
+			Resources:     []string{"customresourcedefinitions"},
+			ResourceNames: names,
+			Verbs:         []string{"get"},
+		},
+	}
+	if scope == definitionsv1alpha1.ClusterScope {
+		rules = append(rules, resourceRules(gvr)...)
+	}
+
 	return rbacv1.ClusterRole{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "rbac.authorization.k8s.io/v1",
 			Kind:       "ClusterRole",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: opts.Name,
-		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{""},
-				Resources: []string{"namespaces"},
-				Verbs:     []string{"*"},
-			},
-			{
-				APIGroups: []string{"apiextensions.k8s.io/v1"},
-				Resources: []string{"crds"},
-				Verbs:     []string{"*"},
-			},
+			Name:   ClusterObjectName(opts),
+			Labels: DefinitionLabels(opts),
 		},
+		Rules: rules,
 	}
 }
+
+// ClusterObjectName returns the name of the cluster scoped objects deployed
+// for the Definition nn: the name of a Definition is only unique in its
+// namespace.
+func ClusterObjectName(nn types.NamespacedName) string {
+	return fmt.Sprintf("%s-%s", nn.Namespace, nn.Name)
+}
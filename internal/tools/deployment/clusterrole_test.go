@@ -4,7 +4,12 @@ import (
 	"context"
 	"testing"
 
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestInstallClusterRole(t *testing.T) {
@@ -13,7 +18,11 @@ func TestInstallClusterRole(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	obj := CreateClusterRole(types.NamespacedName{
+	obj := CreateClusterRole(schema.GroupVersionResource{
+		Group:    "composition.krateo.io",
+		Version:  "v1alpha1",
+		Resource: "demos",
+	}, "", nil, types.NamespacedName{
 		Name:      "demo",
 		Namespace: "default",
 	})
@@ -41,3 +50,23 @@ func TestUninstallClusterRole(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUninstallClusterRoleKeepsForeign(t *testing.T) {
+	nn := types.NamespacedName{Name: "demo", Namespace: "default"}
+	foreign := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: ClusterObjectName(nn)},
+	}
+	kube := fake.NewClientBuilder().WithObjects(foreign).Build()
+
+	err := UninstallClusterRole(context.TODO(), UninstallOptions{
+		KubeClient:     kube,
+		NamespacedName: nn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kube.Get(context.TODO(), client.ObjectKeyFromObject(foreign), &rbacv1.ClusterRole{}); err != nil {
+		t.Fatalf("expected the ClusterRole without the Definition labels to be kept, got: %v", err)
+	}
+}
@@ -24,7 +24,10 @@ func InstallClusterRoleBinding(ctx context.Context, kube client.Client, obj *rba
 				return err
 			}
 
-			return nil
+			if !mergeMetadata(&tmp, obj) {
+				return nil
+			}
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
@@ -33,7 +36,7 @@ func UninstallClusterRoleBinding(ctx context.Context, opts UninstallOptions) err
 	return retry.Do(
 		func() error {
 			obj := rbacv1.ClusterRoleBinding{}
-			err := opts.KubeClient.Get(ctx, opts.NamespacedName, &obj, &client.GetOptions{})
+			err := opts.KubeClient.Get(ctx, client.ObjectKey{Name: ClusterObjectName(opts.NamespacedName)}, &obj, &client.GetOptions{})
 			if err != nil {
 				if apierrors.IsNotFound(err) {
 					return nil
@@ -41,6 +44,10 @@ func UninstallClusterRoleBinding(ctx context.Context, opts UninstallOptions) err
 
 				return err
 			}
+			// an object with the same name deployed by someone else
+			if !hasDefinitionLabels(&obj, opts.NamespacedName) {
+				return nil
+			}
 
 			err = opts.KubeClient.Delete(ctx, &obj, &client.DeleteOptions{})
 			if err != nil {
@@ -68,12 +75,13 @@ func CreateClusterRoleBinding(opts types.NamespacedName) rbacv1.ClusterRoleBindi
 			Kind:       "ClusterRoleBinding",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: opts.Name,
+			Name:   ClusterObjectName(opts),
+			Labels: DefinitionLabels(opts),
 		},
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "ClusterRole",
-			Name:     opts.Name,
+			Name:     ClusterObjectName(opts),
 		},
 		Subjects: []rbacv1.Subject{
 			{
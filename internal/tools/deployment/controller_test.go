@@ -0,0 +1,224 @@
+package deployment
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDeployController(t *testing.T) {
+	kube := fake.NewClientBuilder().WithScheme(clientsetscheme.Scheme).Build()
+
+	nn := types.NamespacedName{Namespace: "demo", Name: "repo-def"}
+	gvr := schema.GroupVersionResource{Group: "github.com", Version: "v1alpha1", Resource: "repoes"}
+
+	err := Deploy(context.TODO(), DeployOptions{
+		KubeClient:     kube,
+		NamespacedName: nn,
+		Spec: &definitionsv1alpha1.DefinitionSpec{
+			ResourceGroup: gvr.Group,
+			Resource:      definitionsv1alpha1.Resource{Kind: "Repo"},
+		},
+		ResourceVersion: gvr.Version,
+		AuthKinds:       []string{"BearerAuth"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dep := appsv1.Deployment{}
+	dep.Name, dep.Namespace = DeploymentName(gvr), nn.Namespace
+	exists, ready, err := LookupDeployment(context.TODO(), kube, &dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || ready {
+		t.Fatalf("expected an existing, not ready deployment, got exists=%t ready=%t", exists, ready)
+	}
+	if dep.Spec.Template.Spec.ServiceAccountName != nn.Name {
+		t.Errorf("expected service account %q, got %q", nn.Name, dep.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	if err := kube.Get(context.TODO(), client.ObjectKey{Name: ClusterObjectName(nn)}, &rbacv1.ClusterRole{}); err != nil {
+		t.Fatal(err)
+	}
+
+	role := rbacv1.Role{}
+	if err := kube.Get(context.TODO(), nn, &role); err != nil {
+		t.Fatal(err)
+	}
+	if got := role.Rules[2].Resources; len(got) != 1 || got[0] != "bearerauths" {
+		t.Errorf("unexpected auth resources: %v", got)
+	}
+
+	// the rules of an installed role follow the auth kinds
+	err = Deploy(context.TODO(), DeployOptions{
+		KubeClient:     kube,
+		NamespacedName: nn,
+		Spec: &definitionsv1alpha1.DefinitionSpec{
+			ResourceGroup: gvr.Group,
+			Resource:      definitionsv1alpha1.Resource{Kind: "Repo"},
+		},
+		ResourceVersion: gvr.Version,
+		AuthKinds:       []string{"BasicAuth"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kube.Get(context.TODO(), nn, &role); err != nil {
+		t.Fatal(err)
+	}
+	if got := role.Rules[2].Resources; len(got) != 1 || got[0] != "basicauths" {
+		t.Errorf("unexpected auth resources after update: %v", got)
+	}
+
+	err = UndeployController(context.TODO(), UndeployOptions{
+		KubeClient:     kube,
+		NamespacedName: nn,
+		GVR:            gvr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{}, &corev1.ServiceAccount{}, &rbacv1.Role{},
+		&rbacv1.RoleBinding{}, &rbacv1.ClusterRole{}, &rbacv1.ClusterRoleBinding{},
+	} {
+		key := nn
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			key.Name = DeploymentName(gvr)
+		case *rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding:
+			key.Namespace = ""
+		}
+		err := kube.Get(context.TODO(), key, obj)
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("expected %T to be removed, got: %v", obj, err)
+		}
+	}
+}
+
+func TestDeploymentName(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "github.com", Version: "v1alpha2", Resource: "repoes"}
+	if got := DeploymentName(gvr); got != "repoes-v1alpha2-controller" {
+		t.Errorf("unexpected deployment name: %s", got)
+	}
+}
+
+func TestRenderoptions(t *testing.T) {
+	t.Setenv(envImageTag, "0.5.0")
+	t.Setenv(envImagePullSecrets, "")
+
+	nn := types.NamespacedName{Namespace: "demo", Name: "repo-def"}
+	gvr := schema.GroupVersionResource{Group: "github.com", Version: "v1alpha1", Resource: "repoes"}
+
+	opts := renderoptions(gvr, nn, nil)
+	if opts.Tag != "0.5.0" || opts.LogLevel != "Debug" || len(opts.ImagePullSecrets) != 0 {
+		t.Errorf("unexpected provider defaults: %+v", opts)
+	}
+
+	replicas := int32(3)
+	opts = renderoptions(gvr, nn, &definitionsv1alpha1.ControllerProfile{
+		Tag:              "0.6.0",
+		LogLevel:         "Info",
+		ImagePullSecrets: []string{"creds"},
+		Replicas:         &replicas,
+	})
+	if opts.Tag != "0.6.0" || opts.LogLevel != "Info" || opts.ImagePullSecrets[0] != "creds" || *opts.Replicas != 3 {
+		t.Errorf("unexpected profile overrides: %+v", opts)
+	}
+}
+
+func TestInstallDeploymentUpdatesOnProfileChange(t *testing.T) {
+	kube := fake.NewClientBuilder().WithScheme(clientsetscheme.Scheme).Build()
+
+	nn := types.NamespacedName{Namespace: "demo", Name: "repo-def"}
+	gvr := schema.GroupVersionResource{Group: "github.com", Version: "v1alpha1", Resource: "repoes"}
+
+	for _, tag := range []string{"0.5.0", "0.5.0", "0.6.0"} {
+		dep, err := CreateDeployment(gvr, nn, &definitionsv1alpha1.ControllerProfile{Tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := InstallDeployment(context.TODO(), kube, &dep); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dep := appsv1.Deployment{}
+	if err := kube.Get(context.TODO(), client.ObjectKey{Namespace: nn.Namespace, Name: DeploymentName(gvr)}, &dep); err != nil {
+		t.Fatal(err)
+	}
+	if got := dep.Spec.Template.Spec.Containers[0].Image; !strings.HasSuffix(got, ":0.6.0") {
+		t.Errorf("expected the deployment to be updated, got image %s", got)
+	}
+}
+
+func TestDeploymentReady(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name   string
+		spec   *int32
+		gen    int64
+		status appsv1.DeploymentStatus
+		want   bool
+	}{
+		{
+			name:   "rolled out",
+			spec:   replicas(2),
+			gen:    3,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 3, UpdatedReplicas: 2, ReadyReplicas: 2},
+			want:   true,
+		},
+		{
+			name:   "scaled to zero",
+			spec:   replicas(0),
+			gen:    3,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 3},
+		},
+		{
+			name:   "no replicas",
+			gen:    1,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 1},
+		},
+		{
+			name:   "spec not observed",
+			spec:   replicas(1),
+			gen:    4,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 3, UpdatedReplicas: 1, ReadyReplicas: 1},
+		},
+		{
+			name:   "old replica set",
+			spec:   replicas(2),
+			gen:    3,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 3, UpdatedReplicas: 1, ReadyReplicas: 2},
+		},
+		{
+			name:   "not ready",
+			spec:   replicas(2),
+			gen:    3,
+			status: appsv1.DeploymentStatus{ObservedGeneration: 3, UpdatedReplicas: 2, ReadyReplicas: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		dep := appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: tc.spec}, Status: tc.status}
+		dep.Generation = tc.gen
+		if got := deploymentReady(&dep); got != tc.want {
+			t.Errorf("%s: expected ready=%t, got %t", tc.name, tc.want, got)
+		}
+	}
+}
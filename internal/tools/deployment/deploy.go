@@ -2,9 +2,14 @@ package deployment
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 
 	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -17,12 +22,30 @@ type UndeployOptions struct {
 	Log            func(msg string, keysAndValues ...any)
 }
 
+// Undeploy removes the controller of the resource and its CRD.
 func Undeploy(ctx context.Context, opts UndeployOptions) error {
+	err := UndeployController(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	err = UninstallCRD(ctx, opts.KubeClient, opts.GVR.GroupResource())
+	if err == nil {
+		if opts.Log != nil {
+			opts.Log("CRD successfully uninstalled", "name", opts.GVR.GroupResource().String())
+		}
+	}
+	return err
+}
+
+// UndeployController removes the controller of the resource, along with its
+// ServiceAccount and RBAC, leaving the CRD installed.
+func UndeployController(ctx context.Context, opts UndeployOptions) error {
 	err := UninstallDeployment(ctx, UninstallOptions{
 		KubeClient: opts.KubeClient,
 		NamespacedName: types.NamespacedName{
 			Namespace: opts.NamespacedName.Namespace,
-			Name:      fmt.Sprintf("%s-%s-controller", opts.GVR.Resource, opts.GVR.Version),
+			Name:      DeploymentName(opts.GVR),
 		},
 		Log: opts.Log,
 	})
@@ -66,22 +89,11 @@ func Undeploy(ctx context.Context, opts UndeployOptions) error {
 		return err
 	}
 
-	err = UninstallServiceAccount(ctx, UninstallOptions{
+	return UninstallServiceAccount(ctx, UninstallOptions{
 		KubeClient:     opts.KubeClient,
 		NamespacedName: opts.NamespacedName,
 		Log:            opts.Log,
 	})
-	if err != nil {
-		return err
-	}
-
-	err = UninstallCRD(ctx, opts.KubeClient, opts.GVR.GroupResource())
-	if err == nil {
-		if opts.Log != nil {
-			opts.Log("CRD successfully uninstalled", "name", opts.GVR.GroupResource().String())
-		}
-	}
-	return err
 }
 
 type DeployOptions struct {
@@ -89,16 +101,48 @@ type DeployOptions struct {
 	NamespacedName  types.NamespacedName
 	Spec            *definitionsv1alpha1.DefinitionSpec
 	ResourceVersion string
-	Log             func(msg string, keysAndValues ...any)
+	// AuthKinds are the kinds of the authentication methods of the resource.
+	AuthKinds []string
+	// Owner is the reference to the Definition set on the objects deployed
+	// in its namespace, which are garbage collected along with it.
+	Owner *metav1.OwnerReference
+	// Installed are the objects installed by a previous DeployChart, the ones
+	// not rendered anymore are deleted.
+	Installed []definitionsv1alpha1.ControllerObject
+	Log       func(msg string, keysAndValues ...any)
 }
 
-func Deploy(ctx context.Context, opts DeployOptions) error {
-	// pkg, err := chartfs.ForSpec(opts.Spec)
-	// if err != nil {
-	// 	return err
-	// }
+// gvr returns the resource reconciled by the controller.
+func (opts DeployOptions) gvr() schema.GroupVersionResource {
+	return ToGroupVersionResourceWithPlural(schema.GroupVersionKind{
+		Group:   opts.Spec.ResourceGroup,
+		Version: opts.ResourceVersion,
+		Kind:    opts.Spec.Resource.Kind,
+	}, opts.Spec.Resource.Plural)
+}
+
+// scope returns the scope of the resource, namespaced when unset.
+func (opts DeployOptions) scope() definitionsv1alpha1.ResourceScope {
+	if len(opts.Spec.Resource.Scope) == 0 {
+		return definitionsv1alpha1.NamespacedScope
+	}
+	return opts.Spec.Resource.Scope
+}
 
+// authResources returns the resources of the authentication kinds.
+func (opts DeployOptions) authResources() []string {
+	res := make([]string, 0, len(opts.AuthKinds))
+	for _, el := range opts.AuthKinds {
+		res = append(res, text.Plural(el, ""))
+	}
+	return res
+}
+
+// Deploy installs the controller of the resource, along with its
+// ServiceAccount and RBAC.
+func Deploy(ctx context.Context, opts DeployOptions) error {
 	sa := CreateServiceAccount(opts.NamespacedName)
+	setOwner(&sa, opts.Owner)
 	if err := InstallServiceAccount(ctx, opts.KubeClient, &sa); err != nil {
 		return err
 	}
@@ -107,55 +151,52 @@ func Deploy(ctx context.Context, opts DeployOptions) error {
 			"name", sa.Name, "namespace", sa.Namespace)
 	}
 
-	gvr := ToGroupVersionResource(schema.GroupVersionKind{
-		Group:   opts.Spec.ResourceGroup,
-		Version: opts.ResourceVersion,
-		Kind:    opts.Spec.Resource.Kind,
-	})
-	// role, err := CreateRole(pkg, gvr.Resource, opts.NamespacedName)
-	// if err != nil {
-	// 	return err
-	// }
-	// if err := InstallRole(ctx, opts.KubeClient, &role); err != nil {
-	// 	return err
-	// }
-	// if opts.Log != nil {
-	// 	opts.Log("Role successfully installed",
-	// 		"gvr", gvr.String(), "name", role.Name, "namespace", role.Namespace)
-	// }
-
-	// rb := CreateRoleBinding(opts.NamespacedName)
-	// if err := InstallRoleBinding(ctx, opts.KubeClient, &rb); err != nil {
-	// 	return err
-	// }
-	// if opts.Log != nil {
-	// 	opts.Log("RoleBinding successfully installed",
-	// 		"gvr", gvr.String(), "name", rb.Name, "namespace", rb.Namespace)
-	// }
-
-	// cr := CreateClusterRole(opts.NamespacedName)
-	// if err := InstallClusterRole(ctx, opts.KubeClient, &cr); err != nil {
-	// 	return err
-	// }
-	// if opts.Log != nil {
-	// 	opts.Log("ClusterRole successfully installed",
-	// 		"gvr", gvr.String(), "name", cr.Name, "namespace", cr.Namespace)
-	// }
-
-	// crb := CreateClusterRoleBinding(opts.NamespacedName)
-	// if err := InstallClusterRoleBinding(ctx, opts.KubeClient, &crb); err != nil {
-	// 	return err
-	// }
-	// if opts.Log != nil {
-	// 	opts.Log("ClusterRoleBinding successfully installed",
-	// 		"gvr", gvr.String(), "name", crb.Name, "namespace", crb.Namespace)
-	// }
-	dep, err := CreateDeployment(gvr, opts.NamespacedName)
+	gvr := opts.gvr()
+	authResources := opts.authResources()
+
+	role := CreateRole(gvr, opts.scope(), authResources, opts.NamespacedName)
+	setOwner(&role, opts.Owner)
+	if err := InstallRole(ctx, opts.KubeClient, &role); err != nil {
+		return err
+	}
+	if opts.Log != nil {
+		opts.Log("Role successfully installed",
+			"gvr", gvr.String(), "name", role.Name, "namespace", role.Namespace)
+	}
+
+	rb := CreateRoleBinding(opts.NamespacedName)
+	setOwner(&rb, opts.Owner)
+	if err := InstallRoleBinding(ctx, opts.KubeClient, &rb); err != nil {
+		return err
+	}
+	if opts.Log != nil {
+		opts.Log("RoleBinding successfully installed",
+			"gvr", gvr.String(), "name", rb.Name, "namespace", rb.Namespace)
+	}
+
+	cr := CreateClusterRole(gvr, opts.scope(), authResources, opts.NamespacedName)
+	if err := InstallClusterRole(ctx, opts.KubeClient, &cr); err != nil {
+		return err
+	}
+	if opts.Log != nil {
+		opts.Log("ClusterRole successfully installed",
+			"gvr", gvr.String(), "name", cr.Name, "namespace", cr.Namespace)
+	}
+
+	crb := CreateClusterRoleBinding(opts.NamespacedName)
+	if err := InstallClusterRoleBinding(ctx, opts.KubeClient, &crb); err != nil {
+		return err
+	}
+	if opts.Log != nil {
+		opts.Log("ClusterRoleBinding successfully installed",
+			"gvr", gvr.String(), "name", crb.Name, "namespace", crb.Namespace)
+	}
+
+	dep, err := CreateDeployment(gvr, opts.NamespacedName, opts.Spec.ControllerProfile)
 	if err != nil {
 		return fmt.Errorf("failed to create deployment: %w", err)
 	}
-	// b, _ := yaml.Marshal(dep)
-	// fmt.Println(string(b))
+	setOwner(&dep, opts.Owner)
 
 	err = InstallDeployment(ctx, opts.KubeClient, &dep)
 	if err != nil {
@@ -168,3 +209,81 @@ func Deploy(ctx context.Context, opts DeployOptions) error {
 
 	return nil
 }
+
+// Manifests returns the objects Deploy or DeployChart would install, without
+// installing them: the KubeClient of the options is not used.
+func Manifests(ctx context.Context, opts DeployOptions) ([]client.Object, error) {
+	if opts.Spec.ControllerChart != nil {
+		objs, err := RenderChart(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render controller chart: %w", err)
+		}
+
+		res := make([]client.Object, 0, len(objs))
+		for _, obj := range objs {
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			for k, v := range DefinitionLabels(opts.NamespacedName) {
+				labels[k] = v
+			}
+			obj.SetLabels(labels)
+			setOwner(obj, opts.Owner)
+			res = append(res, obj)
+		}
+		return res, nil
+	}
+
+	gvr := opts.gvr()
+	authResources := opts.authResources()
+
+	sa := CreateServiceAccount(opts.NamespacedName)
+	role := CreateRole(gvr, opts.scope(), authResources, opts.NamespacedName)
+	rb := CreateRoleBinding(opts.NamespacedName)
+	cr := CreateClusterRole(gvr, opts.scope(), authResources, opts.NamespacedName)
+	crb := CreateClusterRoleBinding(opts.NamespacedName)
+	dep, err := CreateDeployment(gvr, opts.NamespacedName, opts.Spec.ControllerProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+	dep.APIVersion, dep.Kind = appsv1.SchemeGroupVersion.String(), "Deployment"
+
+	res := []client.Object{&sa, &role, &rb, &cr, &crb, &dep}
+	for _, obj := range res {
+		setOwner(obj, opts.Owner)
+	}
+	return res, nil
+}
+
+// Digest returns the digest of the configuration of the controller, which
+// changes whenever Deploy or DeployChart would change the installed objects.
+func Digest(opts DeployOptions) (string, error) {
+	var cfg any
+	if spec := opts.Spec.ControllerChart; spec != nil {
+		values, err := ChartValues(opts)
+		if err != nil {
+			return "", err
+		}
+		cfg = map[string]any{
+			"url":     spec.URL,
+			"version": spec.Version,
+			"values":  values,
+		}
+	} else {
+		dep, err := CreateDeployment(opts.gvr(), opts.NamespacedName, opts.Spec.ControllerProfile)
+		if err != nil {
+			return "", err
+		}
+		cfg = map[string]any{
+			"manifest":      dep.Annotations[annotationKeyManifestHash],
+			"authResources": sortedSet(opts.authResources()),
+		}
+	}
+
+	dat, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(dat)), nil
+}
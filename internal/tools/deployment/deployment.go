@@ -2,9 +2,13 @@ package deployment
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/avast/retry-go"
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
 	"github.com/matteogastaldello/swaggergen-provider/internal/templates"
 	appsv1 "k8s.io/api/apps/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -16,6 +20,21 @@ import (
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
 )
 
+// Environment variables of the provider holding the defaults of the
+// controller deployments, overridden by the profile of each Definition.
+const (
+	envImageRepository  = "CDC_IMAGE_REPOSITORY"
+	envImageTag         = "CDC_IMAGE_TAG"
+	envImagePullSecrets = "CDC_IMAGE_PULL_SECRETS"
+	envLogLevel         = "CDC_LOG_LEVEL"
+)
+
+const (
+	defaultImagePullSecret = "dockerconfigjson-github-com"
+
+	annotationKeyManifestHash = "swaggergen.krateo.io/manifest-hash"
+)
+
 type UninstallOptions struct {
 	KubeClient     client.Client
 	NamespacedName types.NamespacedName
@@ -67,21 +86,27 @@ func InstallDeployment(ctx context.Context, kube client.Client, obj *appsv1.Depl
 				return err
 			}
 
-			return nil
+			// the deployment is updated only when the rendered manifest changes,
+			// leaving alone the fields defaulted by the API server
+			if tmp.Annotations[annotationKeyManifestHash] == obj.Annotations[annotationKeyManifestHash] {
+				if !mergeMetadata(&tmp, obj) {
+					return nil
+				}
+				return kube.Update(ctx, &tmp)
+			}
+			tmp.Labels = obj.Labels
+			tmp.Annotations = obj.Annotations
+			tmp.Spec = obj.Spec
+			mergeMetadata(&tmp, obj)
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
 
-func CreateDeployment(gvr schema.GroupVersionResource, nn types.NamespacedName) (appsv1.Deployment, error) {
-	values := templates.Values(templates.Renderoptions{
-		Group:      gvr.Group,
-		Version:    gvr.Version,
-		Resource:   gvr.Resource,
-		Namespace:  nn.Namespace,
-		Name:       nn.Name,
-		Tag:        os.Getenv("CDC_IMAGE_TAG"),
-		ClientType: "REST",
-	})
+// CreateDeployment renders the Deployment of the controller of gvr. The
+// fields of the profile override the defaults of the provider.
+func CreateDeployment(gvr schema.GroupVersionResource, nn types.NamespacedName, profile *definitionsv1alpha1.ControllerProfile) (appsv1.Deployment, error) {
+	values := templates.Values(renderoptions(gvr, nn, profile))
 
 	dat, err := templates.RenderDeployment(values)
 	if err != nil {
@@ -98,9 +123,91 @@ func CreateDeployment(gvr schema.GroupVersionResource, nn types.NamespacedName)
 
 	res := appsv1.Deployment{}
 	_, _, err = s.Decode(dat, nil, &res)
-	return res, err
+	if err != nil {
+		return res, err
+	}
+
+	if res.Labels == nil {
+		res.Labels = map[string]string{}
+	}
+	for k, v := range DefinitionLabels(nn) {
+		res.Labels[k] = v
+	}
+	if res.Annotations == nil {
+		res.Annotations = map[string]string{}
+	}
+	res.Annotations[annotationKeyManifestHash] = fmt.Sprintf("%x", sha256.Sum256(dat))
+	return res, nil
+}
+
+// renderoptions returns the render options of the controller of gvr: the
+// defaults of the provider, from its environment, overridden by the profile.
+func renderoptions(gvr schema.GroupVersionResource, nn types.NamespacedName, profile *definitionsv1alpha1.ControllerProfile) templates.Renderoptions {
+	opts := templates.Renderoptions{
+		Group:      gvr.Group,
+		Version:    gvr.Version,
+		Resource:   gvr.Resource,
+		Namespace:  nn.Namespace,
+		Name:       nn.Name,
+		Image:      os.Getenv(envImageRepository),
+		Tag:        os.Getenv(envImageTag),
+		ClientType: "REST",
+		// the controllers have always been deployed with debug logs
+		LogLevel:         "Debug",
+		ImagePullSecrets: []string{defaultImagePullSecret},
+	}
+	if val, ok := os.LookupEnv(envLogLevel); ok {
+		opts.LogLevel = val
+	}
+	if val, ok := os.LookupEnv(envImagePullSecrets); ok {
+		opts.ImagePullSecrets = splitList(val)
+	}
+
+	if profile == nil {
+		return opts
+	}
+
+	if len(profile.Image) > 0 {
+		opts.Image = profile.Image
+	}
+	if len(profile.Tag) > 0 {
+		opts.Tag = profile.Tag
+	}
+	if len(profile.ImagePullSecrets) > 0 {
+		opts.ImagePullSecrets = profile.ImagePullSecrets
+	}
+	if len(profile.LogLevel) > 0 {
+		opts.LogLevel = profile.LogLevel
+	}
+	opts.Replicas = profile.Replicas
+	opts.Resources = profile.Resources
+	opts.NodeSelector = profile.NodeSelector
+	opts.Tolerations = profile.Tolerations
+	opts.Affinity = profile.Affinity
+	opts.ExtraArgs = profile.ExtraArgs
+	opts.Env = profile.Env
+
+	return opts
+}
+
+// splitList returns the non empty elements of a comma separated list.
+func splitList(str string) []string {
+	res := []string{}
+	for _, el := range strings.Split(str, ",") {
+		if el = strings.TrimSpace(el); len(el) > 0 {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+// DeploymentName returns the name of the Deployment of the controller of gvr.
+func DeploymentName(gvr schema.GroupVersionResource) string {
+	return fmt.Sprintf("%s-%s-controller", gvr.Resource, gvr.Version)
 }
 
+// LookupDeployment fetches the Deployment into obj and reports whether it
+// exists and whether all its replicas are updated and ready.
 func LookupDeployment(ctx context.Context, kube client.Client, obj *appsv1.Deployment) (bool, bool, error) {
 	err := kube.Get(ctx, client.ObjectKeyFromObject(obj), obj)
 	if err != nil {
@@ -111,7 +218,19 @@ func LookupDeployment(ctx context.Context, kube client.Client, obj *appsv1.Deplo
 		return false, false, err
 	}
 
-	ready := obj.Spec.Replicas != nil && *obj.Spec.Replicas == obj.Status.ReadyReplicas
+	return true, deploymentReady(obj), nil
+}
+
+// deploymentReady reports whether the rollout of the current spec of the
+// Deployment is complete: a Deployment scaled to zero is not ready, which is
+// why the profile of a Definition asks for one replica at least.
+func deploymentReady(obj *appsv1.Deployment) bool {
+	if obj.Spec.Replicas == nil || *obj.Spec.Replicas == 0 {
+		return false
+	}
+	replicas := *obj.Spec.Replicas
 
-	return true, ready, nil
+	return obj.Status.ObservedGeneration >= obj.Generation &&
+		obj.Status.UpdatedReplicas == replicas &&
+		obj.Status.ReadyReplicas == replicas
 }
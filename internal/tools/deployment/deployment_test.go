@@ -21,7 +21,7 @@ func TestInstallDeployment(t *testing.T) {
 		Group:    "composition.krateo.io",
 		Version:  "v12-8-3",
 		Resource: "postgresqls",
-	}, types.NamespacedName{Name: "demo", Namespace: "default"})
+	}, types.NamespacedName{Name: "demo", Namespace: "default"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
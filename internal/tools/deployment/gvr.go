@@ -1,9 +1,7 @@
 package deployment
 
 import (
-	"strings"
-
-	"github.com/gobuffalo/flect"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -37,9 +35,15 @@ import (
 // }
 
 func ToGroupVersionResource(gvk schema.GroupVersionKind) schema.GroupVersionResource {
+	return ToGroupVersionResourceWithPlural(gvk, "")
+}
+
+// ToGroupVersionResourceWithPlural is like ToGroupVersionResource but uses
+// plural as resource name when it is not empty.
+func ToGroupVersionResourceWithPlural(gvk schema.GroupVersionKind, plural string) schema.GroupVersionResource {
 	return schema.GroupVersionResource{
 		Group:    gvk.Group,
 		Version:  gvk.Version,
-		Resource: strings.ToLower(flect.Pluralize(gvk.Kind)),
+		Resource: text.Plural(gvk.Kind, plural),
 	}
 }
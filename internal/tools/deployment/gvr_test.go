@@ -0,0 +1,34 @@
+package deployment
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestToGroupVersionResourceWithPlural(t *testing.T) {
+	gvk := schema.GroupVersionKind{
+		Group:   "azure.devops.com",
+		Version: "v1alpha1",
+		Kind:    "ServiceEndpoint",
+	}
+
+	tests := []struct {
+		plural string
+		want   string
+	}{
+		{plural: "", want: "serviceendpoints"},
+		{plural: "endpoints", want: "endpoints"},
+		{plural: "ServiceConnections", want: "serviceconnections"},
+	}
+
+	for _, tc := range tests {
+		got := ToGroupVersionResourceWithPlural(gvk, tc.plural)
+		if got.Resource != tc.want {
+			t.Errorf("plural %q: expected resource %q, got %q", tc.plural, tc.want, got.Resource)
+		}
+		if got.Group != gvk.Group || got.Version != gvk.Version {
+			t.Errorf("plural %q: unexpected group/version %s", tc.plural, got.GroupVersion())
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !integration
+// +build !integration
+
+package deployment
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// setupKubeClient returns an in-memory client: the integration tests run
+// the same tests against the cluster of the kubeconfig in the home directory.
+func setupKubeClient() (client.Client, error) {
+	return fake.NewClientBuilder().Build(), nil
+}
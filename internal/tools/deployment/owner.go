@@ -0,0 +1,201 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Labels identifying the Definition that deployed an object.
+const (
+	LabelKeyDefinitionName      = "swaggergen.krateo.io/definition-name"
+	LabelKeyDefinitionNamespace = "swaggergen.krateo.io/definition-namespace"
+	// LabelKeyAuthentication marks the CRDs of the authentication kinds,
+	// which the Definitions of a group share.
+	LabelKeyAuthentication = "swaggergen.krateo.io/authentication"
+)
+
+// sweptKinds are the kinds of the objects deployed for a Definition. CRDs
+// are never swept: deleting a CRD deletes all its custom resources, and the
+// deletion policy of a Definition that no longer exists is unknown.
+var sweptKinds = []schema.GroupVersionKind{
+	appsv1.SchemeGroupVersion.WithKind("Deployment"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+	rbacv1.SchemeGroupVersion.WithKind("RoleBinding"),
+	rbacv1.SchemeGroupVersion.WithKind("Role"),
+	corev1.SchemeGroupVersion.WithKind("ServiceAccount"),
+}
+
+// DefinitionLabels returns the labels of the objects deployed for the
+// Definition nn.
+func DefinitionLabels(nn types.NamespacedName) map[string]string {
+	return map[string]string{
+		LabelKeyDefinitionName:      nn.Name,
+		LabelKeyDefinitionNamespace: nn.Namespace,
+	}
+}
+
+// hasDefinitionLabels reports whether obj has been deployed for the
+// Definition nn.
+func hasDefinitionLabels(obj metav1.Object, nn types.NamespacedName) bool {
+	labels := obj.GetLabels()
+	return labels[LabelKeyDefinitionName] == nn.Name &&
+		labels[LabelKeyDefinitionNamespace] == nn.Namespace
+}
+
+// OwnerReference returns the reference to the Definition owning the
+// objects deployed in its namespace.
+func OwnerReference(cr *definitionsv1alpha1.Definition) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: definitionsv1alpha1.DefinitionGroupVersionKind.GroupVersion().String(),
+		Kind:       definitionsv1alpha1.DefinitionGroupVersionKind.Kind,
+		Name:       cr.Name,
+		UID:        cr.UID,
+		Controller: &controller,
+	}
+}
+
+// setOwner adds owner to the owner references of obj; cluster scoped objects
+// cannot be owned by a Definition and are left alone.
+func setOwner(obj metav1.Object, owner *metav1.OwnerReference) {
+	if owner == nil || len(obj.GetNamespace()) == 0 {
+		return
+	}
+	obj.SetOwnerReferences(mergeOwnerReferences(obj.GetOwnerReferences(), *owner))
+}
+
+// mergeMetadata copies the labels and the owner references of src into dst
+// and reports whether dst changed, so that the objects installed before
+// being labelled get their labels.
+func mergeMetadata(dst, src metav1.Object) bool {
+	changed := false
+
+	labels := dst.GetLabels()
+	for k, v := range src.GetLabels() {
+		if cur, ok := labels[k]; ok && cur == v {
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[k] = v
+		changed = true
+	}
+	dst.SetLabels(labels)
+
+	refs := dst.GetOwnerReferences()
+	for _, el := range src.GetOwnerReferences() {
+		if !hasOwnerReference(refs, el) {
+			refs = mergeOwnerReferences(refs, el)
+			changed = true
+		}
+	}
+	dst.SetOwnerReferences(refs)
+
+	return changed
+}
+
+func mergeOwnerReferences(refs []metav1.OwnerReference, ref metav1.OwnerReference) []metav1.OwnerReference {
+	if hasOwnerReference(refs, ref) {
+		return refs
+	}
+	return append(refs, ref)
+}
+
+func hasOwnerReference(refs []metav1.OwnerReference, ref metav1.OwnerReference) bool {
+	for _, el := range refs {
+		if el.UID == ref.UID {
+			return true
+		}
+	}
+	return false
+}
+
+type SweepOptions struct {
+	KubeClient client.Client
+	// Reader lists the deployed objects, it defaults to KubeClient: an
+	// uncached reader avoids watching all the objects of the swept kinds.
+	Reader client.Reader
+	Log    func(msg string, keysAndValues ...any)
+}
+
+// Sweep deletes the objects labelled for a Definition that no longer exists,
+// e.g. the ones left behind by a Definition deleted while the provider was
+// not running. The failures do not stop the sweep, they are returned
+// together once every object has been processed.
+func Sweep(ctx context.Context, opts SweepOptions) error {
+	reader := opts.Reader
+	if reader == nil {
+		reader = opts.KubeClient
+	}
+
+	exists := map[types.NamespacedName]bool{}
+	definitionExists := func(nn types.NamespacedName) (bool, error) {
+		if res, ok := exists[nn]; ok {
+			return res, nil
+		}
+
+		obj := metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(definitionsv1alpha1.DefinitionGroupVersionKind)
+		err := reader.Get(ctx, nn, &obj)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		// a Definition being deleted removes its objects by itself
+		exists[nn] = err == nil
+		return exists[nn], nil
+	}
+
+	errs := []error{}
+	for _, gvk := range sweptKinds {
+		list := metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := reader.List(ctx, &list, client.HasLabels{LabelKeyDefinitionName, LabelKeyDefinitionNamespace})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing %s: %w", gvk.Kind, err))
+			continue
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			obj.SetGroupVersionKind(gvk)
+
+			ok, err := definitionExists(types.NamespacedName{
+				Namespace: obj.Labels[LabelKeyDefinitionNamespace],
+				Name:      obj.Labels[LabelKeyDefinitionName],
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("getting the Definition of %s '%s': %w", gvk.Kind, obj.Name, err))
+				continue
+			}
+			if ok {
+				continue
+			}
+
+			err = opts.KubeClient.Delete(ctx, obj)
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("deleting %s '%s': %w", gvk.Kind, obj.Name, err))
+				continue
+			}
+			if opts.Log != nil {
+				opts.Log(fmt.Sprintf("Orphaned %s successfully deleted", gvk.Kind),
+					"name", obj.Name, "namespace", obj.Namespace,
+					"definition", obj.Labels[LabelKeyDefinitionName])
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,190 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newOwnerClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	for _, fn := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		apiextensionsv1.AddToScheme,
+		definitionsv1alpha1.SchemeBuilder.AddToScheme,
+	} {
+		if err := fn(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestDeployOwnedObjects(t *testing.T) {
+	def := &definitionsv1alpha1.Definition{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespacedName.Namespace,
+			Name:      testNamespacedName.Name,
+			UID:       types.UID("0d6c5e2a-7b0f-4a53-9a39-0c7f6d1e2b44"),
+		},
+	}
+	// installed before the objects were labelled
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespacedName.Namespace,
+			Name:      testNamespacedName.Name,
+		},
+	}
+	kube := newOwnerClient(t, sa)
+
+	owner := OwnerReference(def)
+	err := Deploy(context.TODO(), DeployOptions{
+		KubeClient:     kube,
+		NamespacedName: testNamespacedName,
+		Spec: &definitionsv1alpha1.DefinitionSpec{
+			ResourceGroup: testGVR.Group,
+			Resource:      definitionsv1alpha1.Resource{Kind: "Repo"},
+		},
+		ResourceVersion: testGVR.Version,
+		Owner:           &owner,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range []client.Object{
+		&corev1.ServiceAccount{}, &rbacv1.Role{}, &rbacv1.RoleBinding{}, &appsv1.Deployment{},
+		&rbacv1.ClusterRole{}, &rbacv1.ClusterRoleBinding{},
+	} {
+		key := testNamespacedName
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			key.Name = DeploymentName(testGVR)
+		case *rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding:
+			key = types.NamespacedName{Name: ClusterObjectName(testNamespacedName)}
+		}
+		if err := kube.Get(context.TODO(), key, obj); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := obj.GetLabels()[LabelKeyDefinitionName]; got != testNamespacedName.Name {
+			t.Errorf("%T: expected the definition label, got %q", obj, got)
+		}
+		refs := obj.GetOwnerReferences()
+		if len(key.Namespace) == 0 {
+			if len(refs) != 0 {
+				t.Errorf("%T: unexpected owner references on a cluster scoped object: %v", obj, refs)
+			}
+			continue
+		}
+		if len(refs) != 1 || refs[0].UID != def.UID || refs[0].Kind != "Definition" {
+			t.Errorf("%T: expected to be owned by the definition, got %v", obj, refs)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	alive := types.NamespacedName{Namespace: "demo", Name: "alive"}
+	gone := types.NamespacedName{Namespace: "demo", Name: "gone"}
+
+	objs := []client.Object{
+		&definitionsv1alpha1.Definition{
+			ObjectMeta: metav1.ObjectMeta{Namespace: alive.Namespace, Name: alive.Name},
+		},
+	}
+	for _, nn := range []types.NamespacedName{alive, gone} {
+		sa := CreateServiceAccount(nn)
+		cr := CreateClusterRole(testGVR, "", nil, nn)
+		objs = append(objs, &sa, &cr)
+	}
+	// deleting a CRD would delete its custom resources, orphaned or not
+	objs = append(objs,
+		&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "repoes.github.com", Labels: DefinitionLabels(gone)},
+		},
+		&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "bearerauths.github.com", Labels: map[string]string{
+				LabelKeyDefinitionName:      gone.Name,
+				LabelKeyDefinitionNamespace: gone.Namespace,
+				LabelKeyAuthentication:      "true",
+			}},
+		},
+		// not deployed by a Definition
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "default"},
+		},
+	)
+	kube := newOwnerClient(t, objs...)
+
+	if err := Sweep(context.TODO(), SweepOptions{KubeClient: kube}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		obj     client.Object
+		key     client.ObjectKey
+		removed bool
+	}{
+		{&corev1.ServiceAccount{}, client.ObjectKey(alive), false},
+		{&rbacv1.ClusterRole{}, client.ObjectKey{Name: ClusterObjectName(alive)}, false},
+		{&corev1.ServiceAccount{}, client.ObjectKey(gone), true},
+		{&rbacv1.ClusterRole{}, client.ObjectKey{Name: ClusterObjectName(gone)}, true},
+		{&apiextensionsv1.CustomResourceDefinition{}, client.ObjectKey{Name: "repoes.github.com"}, false},
+		{&apiextensionsv1.CustomResourceDefinition{}, client.ObjectKey{Name: "bearerauths.github.com"}, false},
+		{&corev1.ServiceAccount{}, client.ObjectKey{Namespace: "demo", Name: "default"}, false},
+	}
+	for _, tc := range tests {
+		err := kube.Get(context.TODO(), tc.key, tc.obj)
+		if tc.removed && !apierrors.IsNotFound(err) {
+			t.Errorf("expected %T %s to be swept, got: %v", tc.obj, tc.key, err)
+		}
+		if !tc.removed && err != nil {
+			t.Errorf("expected %T %s to be kept, got: %v", tc.obj, tc.key, err)
+		}
+	}
+}
+
+func TestSweepKeepsGoing(t *testing.T) {
+	gone := types.NamespacedName{Namespace: "demo", Name: "gone"}
+	sa := CreateServiceAccount(gone)
+	cr := CreateClusterRole(testGVR, "", nil, gone)
+	role := CreateRole(testGVR, "", nil, gone)
+
+	kube := interceptor.NewClient(newOwnerClient(t, &sa, &cr, &role).(client.WithWatch), interceptor.Funcs{
+		Delete: func(ctx context.Context, kube client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if obj.GetObjectKind().GroupVersionKind().Kind == "ClusterRole" {
+				return errors.New("forbidden")
+			}
+			return kube.Delete(ctx, obj, opts...)
+		},
+	})
+
+	err := Sweep(context.TODO(), SweepOptions{KubeClient: kube})
+	if err == nil || !strings.Contains(err.Error(), "deleting ClusterRole 'demo-gone': forbidden") {
+		t.Fatalf("expected the ClusterRole deletion error, got: %v", err)
+	}
+
+	for _, obj := range []client.Object{&rbacv1.Role{}, &corev1.ServiceAccount{}} {
+		if err := kube.Get(context.TODO(), client.ObjectKey(gone), obj); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %T to be swept after the failure, got: %v", obj, err)
+		}
+	}
+}
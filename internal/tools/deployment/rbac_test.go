@@ -0,0 +1,116 @@
+package deployment
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/golden"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	testGVR = schema.GroupVersionResource{
+		Group:    "github.com",
+		Version:  "v1alpha1",
+		Resource: "repoes",
+	}
+	testAuthResources  = []string{"bearerauths", "basicauths", "bearerauths"}
+	testNamespacedName = types.NamespacedName{
+		Namespace: "demo",
+		Name:      "repo-def",
+	}
+)
+
+func TestCreateRole(t *testing.T) {
+	obj := CreateRole(testGVR, definitionsv1alpha1.NamespacedScope, testAuthResources, testNamespacedName)
+
+	dat, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, filepath.Join("testdata", "role.yaml.golden"), dat)
+}
+
+func TestCreateRoleWithoutAuth(t *testing.T) {
+	obj := CreateRole(testGVR, "", nil, testNamespacedName)
+
+	for _, el := range obj.Rules {
+		for _, res := range el.Resources {
+			if res == "bearerauths" || res == "basicauths" {
+				t.Fatalf("unexpected auth rule: %v", el)
+			}
+		}
+	}
+	if len(obj.Rules) != 5 {
+		t.Errorf("expected 5 rules, got %d", len(obj.Rules))
+	}
+}
+
+func TestCreateClusterRole(t *testing.T) {
+	obj := CreateClusterRole(testGVR, definitionsv1alpha1.NamespacedScope, testAuthResources, testNamespacedName)
+
+	dat, err := yaml.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, filepath.Join("testdata", "clusterrole.yaml.golden"), dat)
+}
+
+func TestClusterScopedRBAC(t *testing.T) {
+	role := CreateRole(testGVR, definitionsv1alpha1.ClusterScope, testAuthResources, testNamespacedName)
+	for _, el := range role.Rules {
+		for _, res := range el.Resources {
+			if res == testGVR.Resource || res == testGVR.Resource+"/status" {
+				t.Errorf("unexpected namespaced rule on a cluster scoped resource: %v", el)
+			}
+		}
+	}
+	// the auth resources, the secrets, the definitions and the events
+	if len(role.Rules) != 4 {
+		t.Errorf("expected 4 rules, got %d", len(role.Rules))
+	}
+
+	cr := CreateClusterRole(testGVR, definitionsv1alpha1.ClusterScope, testAuthResources, testNamespacedName)
+	if len(cr.Rules) != 3 {
+		t.Fatalf("expected the CRD and the resource rules, got %v", cr.Rules)
+	}
+	if got := cr.Rules[1].Resources; len(got) != 1 || got[0] != testGVR.Resource {
+		t.Errorf("unexpected cluster rule: %v", cr.Rules[1])
+	}
+	for _, el := range cr.Rules {
+		for _, res := range el.Resources {
+			if res == "secrets" {
+				t.Errorf("unexpected cluster wide access to secrets: %v", el)
+			}
+		}
+	}
+}
+
+func TestCreatePolicyInfo(t *testing.T) {
+	manifest := "apiVersion: github.com/v1alpha1\nkind: Repo\n"
+
+	tests := []struct {
+		plural string
+		want   string
+	}{
+		{"", "repoes"},
+		{"repositories", "repositories"},
+	}
+
+	for _, tc := range tests {
+		dec := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+		nfo, err := createPolicyInfo(dec, tc.plural)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nfo.group != "github.com" || nfo.resource != tc.want {
+			t.Errorf("plural %q: expected github.com/%s, got %s/%s", tc.plural, tc.want, nfo.group, nfo.resource)
+		}
+	}
+}
@@ -2,16 +2,20 @@ package deployment
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"sort"
 
 	"github.com/avast/retry-go"
-	"github.com/gobuffalo/flect"
+	definitionsv1alpha1 "github.com/matteogastaldello/swaggergen-provider/apis/definitions/v1alpha1"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
 	"sigs.k8s.io/yaml"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -61,88 +65,103 @@ func InstallRole(ctx context.Context, kube client.Client, obj *rbacv1.Role) erro
 				return err
 			}
 
-			return nil
+			// the rules follow the generated kinds
+			changed := mergeMetadata(&tmp, obj)
+			if !changed && equality.Semantic.DeepEqual(tmp.Rules, obj.Rules) {
+				return nil
+			}
+			tmp.Rules = obj.Rules
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
 
-// func CreateRole(pkg *chartfs.ChartFS, resource string, opts types.NamespacedName) (rbacv1.Role, error) {
-// 	rend, err := RenderChartTemplates(pkg)
-// 	if err != nil {
-// 		return rbacv1.Role{}, err
-// 	}
-
-// 	if len(rend) == 0 {
-// 		return rbacv1.Role{}, fmt.Errorf("no entries in manifest")
-// 	}
-
-// 	role := rbacv1.Role{
-// 		TypeMeta: metav1.TypeMeta{
-// 			APIVersion: "rbac.authorization.k8s.io/v1",
-// 			Kind:       "Role",
-// 		},
-// 		ObjectMeta: metav1.ObjectMeta{
-// 			Name:      opts.Name,
-// 			Namespace: opts.Namespace,
-// 		},
-// 		Rules: []rbacv1.PolicyRule{
-// 			{
-// 				APIGroups: []string{"core.krateo.io"},
-// 				Resources: []string{"definitions", "definitions/status"},
-// 				Verbs:     []string{"*"},
-// 			},
-// 			{
-// 				APIGroups: []string{"composition.krateo.io"},
-// 				Resources: []string{resource, fmt.Sprintf("%s/status", resource)},
-// 				Verbs:     []string{"*"},
-// 			},
-// 		},
-// 	}
-
-// 	pols := map[string]map[string]bool{
-// 		"": {"secrets": true, "namespaces": true},
-// 	}
-
-// 	mdr := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(rend)))
-// 	for {
-// 		nfo, err := createPolicyInfo(mdr)
-// 		if err != nil {
-// 			if errors.Is(err, io.EOF) {
-// 				break
-// 			}
-// 			return role, err
-// 		}
-// 		if len(nfo.resource) == 0 {
-// 			continue
-// 		}
-
-// 		lst, ok := pols[nfo.group]
-// 		if !ok {
-// 			lst = map[string]bool{}
-// 			pols[nfo.group] = lst
-// 		}
-// 		if _, exists := lst[nfo.resource]; !exists {
-// 			lst[nfo.resource] = true
-// 		}
-// 	}
-
-// 	for grp, res := range pols {
-// 		keys := make([]string, 0, len(res))
-// 		for k := range res {
-// 			keys = append(keys, k)
-// 		}
-
-// 		role.Rules = append(role.Rules, rbacv1.PolicyRule{
-// 			APIGroups: []string{grp},
-// 			Resources: keys,
-// 			Verbs:     []string{"*"},
-// 		})
-// 	}
-
-// 	return role, nil
-// }
-
-func createPolicyInfo(dec *utilyaml.YAMLReader) (nfo policytInfo, err error) {
+// CreateRole returns the Role of the controller of gvr, limited to what it
+// manages in its namespace: the resource and its status, the authentication
+// resources and the Secrets they refer to, the Definitions and the events.
+// The rules on a cluster scoped resource are granted by the ClusterRole.
+func CreateRole(gvr schema.GroupVersionResource, scope definitionsv1alpha1.ResourceScope, authResources []string, opts types.NamespacedName) rbacv1.Role {
+	rules := []rbacv1.PolicyRule{}
+	if scope != definitionsv1alpha1.ClusterScope {
+		rules = append(rules, resourceRules(gvr)...)
+	}
+
+	if auth := sortedSet(authResources); len(auth) > 0 {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{gvr.Group},
+			Resources: auth,
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+
+	rules = append(rules,
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{definitionsv1alpha1.Group},
+			Resources: []string{"definitions"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		},
+	)
+
+	return rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "rbac.authorization.k8s.io/v1",
+			Kind:       "Role",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    DefinitionLabels(opts),
+		},
+		Rules: rules,
+	}
+}
+
+// resourceRules returns the rules on gvr and on its status.
+func resourceRules(gvr schema.GroupVersionResource) []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{gvr.Group},
+			Resources: []string{gvr.Resource},
+			Verbs:     []string{"get", "list", "watch", "update", "patch"},
+		},
+		{
+			APIGroups: []string{gvr.Group},
+			Resources: []string{fmt.Sprintf("%s/status", gvr.Resource)},
+			Verbs:     []string{"get", "update", "patch"},
+		},
+	}
+}
+
+// sortedSet returns the sorted, distinct, non empty elements of lst.
+func sortedSet(lst []string) []string {
+	set := map[string]bool{}
+	for _, el := range lst {
+		if len(el) > 0 {
+			set[el] = true
+		}
+	}
+
+	res := make([]string, 0, len(set))
+	for el := range set {
+		res = append(res, el)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// createPolicyInfo reads the group and resource of the next manifest of dec;
+// plural, when set, overrides the plural of its kind.
+func createPolicyInfo(dec *utilyaml.YAMLReader, plural string) (nfo policytInfo, err error) {
 	buf, err := dec.Read()
 	if err != nil {
 		return nfo, err
@@ -162,7 +181,7 @@ func createPolicyInfo(dec *utilyaml.YAMLReader) (nfo policytInfo, err error) {
 	}
 
 	nfo.group = gv.Group
-	nfo.resource = strings.ToLower(flect.Pluralize(tm.Kind))
+	nfo.resource = text.Plural(tm.Kind, plural)
 	return nfo, err
 }
 
@@ -56,7 +56,10 @@ func InstallRoleBinding(ctx context.Context, kube client.Client, obj *rbacv1.Rol
 				return err
 			}
 
-			return nil
+			if !mergeMetadata(&tmp, obj) {
+				return nil
+			}
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
@@ -70,6 +73,7 @@ func CreateRoleBinding(opts types.NamespacedName) rbacv1.RoleBinding {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    DefinitionLabels(opts),
 		},
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
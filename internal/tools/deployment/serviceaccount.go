@@ -56,7 +56,10 @@ func InstallServiceAccount(ctx context.Context, kube client.Client, obj *corev1.
 				return err
 			}
 
-			return nil
+			if !mergeMetadata(&tmp, obj) {
+				return nil
+			}
+			return kube.Update(ctx, &tmp)
 		},
 	)
 }
@@ -70,6 +73,7 @@ func CreateServiceAccount(opts types.NamespacedName) corev1.ServiceAccount {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    DefinitionLabels(opts),
 		},
 	}
 }
@@ -7,14 +7,30 @@ import (
 )
 
 type Resource struct {
-	Group        string
-	Version      string
-	Kind         string
-	Categories   []string
-	Schema       []byte
-	StatusSchema []byte
-	AuthSchemas  *map[string][]byte
-	IsManaged    bool
+	Group          string
+	Version        string
+	Kind           string
+	Categories     []string
+	Plural         string
+	Singular       string
+	ShortNames     []string
+	PrinterColumns []PrinterColumn
+	Schema         []byte
+	StatusSchema   []byte
+	AuthSchemas    *map[string][]byte
+	IsManaged      bool
+	// Scope is the scope of the resource, Namespaced (the default) or Cluster.
+	Scope string
+	// MaxRecursionDepth is the number of times recursive schemas are unrolled (see transpiler.Options).
+	MaxRecursionDepth int
+}
+
+// PrinterColumn describes an additional column shown by 'kubectl get'.
+type PrinterColumn struct {
+	Name     string
+	Type     string
+	JSONPath string
+	Priority int
 }
 
 type Options struct {
@@ -22,47 +38,49 @@ type Options struct {
 	Workdir string
 }
 
-func Do(res *Resource, cfg Options) error {
-	err := CreateGenerateDotGo(cfg.Workdir)
+// Do writes the sources of the resource in the working directory. It returns
+// the warnings raised while generating the types.
+func Do(res *Resource, cfg Options) (warnings []string, err error) {
+	err = CreateGenerateDotGo(cfg.Workdir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = CreateTypesDotGo(cfg.Workdir, res)
+	warnings, err = CreateTypesDotGo(cfg.Workdir, res)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = CreateGroupVersionInfoDotGo(cfg.Workdir, res)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = CreateApisDotGo(res, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = os.Mkdir(filepath.Join(cfg.Workdir, "crds"), os.ModePerm)
 	if err != nil {
 		if !errors.Is(err, os.ErrExist) {
-			return err
+			return nil, err
 		}
 	}
 
 	err = os.Mkdir(filepath.Join(cfg.Workdir, "hack"), os.ModePerm)
 	if err != nil {
 		if !errors.Is(err, os.ErrExist) {
-			return err
+			return nil, err
 		}
 	}
 
 	fp, err := os.Create(filepath.Join(cfg.Workdir, "hack", "boilerplate.go.txt"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer fp.Close()
 
 	_, err = fp.WriteString("// Copyright 2024 KrateoPlatformOps.")
-	return err
+	return warnings, err
 }
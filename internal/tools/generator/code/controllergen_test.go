@@ -0,0 +1,138 @@
+//go:build integration
+// +build integration
+
+package code
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// TestBuildCRDMatchesControllerGen runs the controller-gen version pinned
+// in go.mod on the types.go of the fixtures and diffs its CRDs with the
+// ones built in-process. It needs a Go toolchain able to build that version
+// of controller-gen (e.g. GOTOOLCHAIN=go1.21.6).
+func TestBuildCRDMatchesControllerGen(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(res *Resource)
+	}{
+		{
+			name: "managed",
+			edit: func(res *Resource) {
+				res.ShortNames = []string{"rp"}
+				res.PrinterColumns = []PrinterColumn{
+					{Name: "Name", JSONPath: ".spec.name"},
+					{Name: "Size", Type: "integer", JSONPath: ".spec.size", Priority: 1},
+					{Name: `Owner, "login"`, JSONPath: ".spec.owner"},
+				}
+			},
+		},
+		{
+			name: "cluster scoped with overrides",
+			edit: func(res *Resource) {
+				res.Version = "v1"
+				res.Scope = "Cluster"
+				res.Plural, res.Singular = "repositories", "repository"
+			},
+		},
+		{
+			name: "decimal bounds",
+			edit: func(res *Resource) {
+				res.Schema = []byte(`{
+					"type": "object",
+					"properties": {
+						"ratio": {"type": "number", "minimum": 0.5, "maximum": 10, "exclusiveMaximum": true, "multipleOf": 0.5},
+						"count": {"type": "integer", "format": "int32", "minimum": 1}
+					}
+				}`)
+			},
+		},
+		{
+			name: "authentication",
+			edit: func(res *Resource) {
+				res.Kind = "BearerAuth"
+				res.Schema = []byte(`{
+					"type": "object",
+					"properties": {"tokenRef": {"type": "object", "properties": {"name": {"type": "string"}}}}
+				}`)
+				res.StatusSchema = nil
+				res.AuthSchemas = nil
+				res.IsManaged = false
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := testResource(t)
+			tc.edit(res)
+
+			got, _, err := BuildCRD(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := runControllerGen(t, res)
+			if diff := cmp.Diff(want.Spec, got.Spec); diff != "" {
+				t.Errorf("in-process CRD differs from controller-gen (-controller-gen +in-process):\n%s", diff)
+			}
+			if want.Name != got.Name {
+				t.Errorf("expected the CRD name %s, got %s", want.Name, got.Name)
+			}
+		})
+	}
+}
+
+// runControllerGen writes the types of res in a package of this module,
+// so that controller-gen resolves the same dependencies, and returns the
+// CRD controller-gen generates from them.
+func runControllerGen(t *testing.T, res *Resource) *apiextensionsv1.CustomResourceDefinition {
+	t.Helper()
+	workdir, err := os.MkdirTemp(".", "controllergen-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(workdir) })
+
+	if _, err := CreateTypesDotGo(workdir, res); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateGroupVersionInfoDotGo(workdir, res); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	cmd := exec.Command("go", "run", "sigs.k8s.io/controller-tools/cmd/controller-gen",
+		"object", "crd:crdVersions=v1",
+		"paths=./"+filepath.ToSlash(workdir)+"/...",
+		"output:crd:artifacts:config="+out,
+	)
+	if dat, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("running controller-gen: %v\n%s", err, dat)
+	}
+
+	files, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one CRD, got %d", len(files))
+	}
+	dat, err := os.ReadFile(filepath.Join(out, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(dat, crd); err != nil {
+		t.Fatal(err)
+	}
+	return crd
+}
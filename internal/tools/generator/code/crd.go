@@ -0,0 +1,416 @@
+package code
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	descAPIVersion = "APIVersion defines the versioned schema of this representation of an object. " +
+		"Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. " +
+		"More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources"
+	descKind = "Kind is a string value representing the REST resource this object represents. " +
+		"Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. " +
+		"More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds"
+	descDeletionPolicy = `DeletionPolicy specifies what will happen to the underlying external ` +
+		`when this managed resource is deleted - either "Delete" or "Orphan" the external resource.`
+)
+
+// BuildCRD builds the CRD of the resource in-process, without writing the
+// Go types and running controller-gen on them. The result is the one
+// controller-gen produces for the types written by CreateTypesDotGo, but for
+// the controller-gen version annotation.
+// It returns the same warnings as CreateTypesDotGo.
+func BuildCRD(res *Resource) (*apiextensionsv1.CustomResourceDefinition, []string, error) {
+	info, statusStruct, warnings, err := buildTypes(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kind := text.ToGolangName(res.Kind)
+	b := &crdBuilder{structs: info}
+
+	spec, err := b.specSchema(res, info["Root"])
+	if err != nil {
+		return nil, nil, err
+	}
+	spec.Description = fmt.Sprintf(pkgSpecCommentFmt, text.ToGolangName(fmt.Sprintf("%sSpec", kind)), kind)
+
+	status, err := b.structSchema(statusStruct["Root"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := apiextensionsv1.CustomResourceDefinitionNames{
+		Kind:       kind,
+		ListKind:   fmt.Sprintf("%sList", kind),
+		Plural:     plural(res),
+		Singular:   strings.ToLower(kind),
+		Categories: res.Categories,
+		ShortNames: res.ShortNames,
+	}
+	if len(res.Singular) > 0 {
+		names.Singular = res.Singular
+	}
+
+	// ObjectMeta is inlined in the generated types, its (empty) schema is
+	// merged in the root one instead of being the metadata property.
+	root := apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"apiVersion": {Type: "string", Description: descAPIVersion},
+			"kind":       {Type: "string", Description: descKind},
+			"spec":       spec,
+			"status":     status,
+		},
+	}
+
+	return &apiextensionsv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s.%s", names.Plural, res.Group),
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: res.Group,
+			Names: names,
+			Scope: resourceScope(res),
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:                     res.Version,
+					Served:                   true,
+					Storage:                  true,
+					AdditionalPrinterColumns: printerColumns(res),
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &root,
+					},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{
+						Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+					},
+				},
+			},
+		},
+	}, warnings, nil
+}
+
+// MarshalCRD renders the CRD as controller-gen does: keys are sorted and
+// the status and creation timestamp are omitted.
+func MarshalCRD(crd *apiextensionsv1.CustomResourceDefinition) ([]byte, error) {
+	dat, err := json.Marshal(crd)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(dat, &obj); err != nil {
+		return nil, err
+	}
+	delete(obj, "status")
+	if meta, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(meta, "creationTimestamp")
+	}
+
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("---\n"), out...), nil
+}
+
+// resourceScope returns the scope of the resource, namespaced by default.
+func resourceScope(res *Resource) apiextensionsv1.ResourceScope {
+	if res.Scope == string(apiextensionsv1.ClusterScoped) {
+		return apiextensionsv1.ClusterScoped
+	}
+	return apiextensionsv1.NamespaceScoped
+}
+
+// printerColumns returns the columns of the printcolumn markers, in the same order.
+func printerColumns(res *Resource) []apiextensionsv1.CustomResourceColumnDefinition {
+	cols := make([]apiextensionsv1.CustomResourceColumnDefinition, 0, len(res.PrinterColumns)+2)
+	for _, el := range res.PrinterColumns {
+		typ := el.Type
+		if len(typ) == 0 {
+			typ = "string"
+		}
+		cols = append(cols, apiextensionsv1.CustomResourceColumnDefinition{
+			Name:     strings.ToUpper(el.Name),
+			Type:     typ,
+			JSONPath: el.JSONPath,
+			Priority: int32(el.Priority),
+		})
+	}
+
+	return append(cols,
+		apiextensionsv1.CustomResourceColumnDefinition{
+			Name: "AGE", Type: "date", JSONPath: ".metadata.creationTimestamp",
+		},
+		apiextensionsv1.CustomResourceColumnDefinition{
+			Name: "READY", Type: "string", JSONPath: ".status.conditions[?(@.type=='Ready')].status",
+		})
+}
+
+// crdBuilder converts the structs rendered in types.go to the schemas
+// controller-gen would derive from them.
+type crdBuilder struct {
+	structs map[string]transpiler.Struct
+	// structs being converted, to detect recursive types
+	visiting []string
+}
+
+// specSchema returns the schema of the spec struct, which embeds the
+// managed spec and references the authentication methods.
+func (b *crdBuilder) specSchema(res *Resource, el transpiler.Struct) (apiextensionsv1.JSONSchemaProps, error) {
+	props, err := b.structSchema(el)
+	if err != nil {
+		return props, err
+	}
+
+	for _, f := range authRefFields(res) {
+		p, err := b.fieldSchema(f)
+		if err != nil {
+			return props, err
+		}
+		props.Properties[f.JSONName] = p
+	}
+
+	props.Properties["deletionPolicy"] = apiextensionsv1.JSONSchemaProps{
+		Type:        "string",
+		Description: descDeletionPolicy,
+		Default:     &apiextensionsv1.JSON{Raw: []byte(`"Delete"`)},
+		Enum: []apiextensionsv1.JSON{
+			{Raw: []byte(`"Orphan"`)},
+			{Raw: []byte(`"Delete"`)},
+		},
+	}
+
+	return props, nil
+}
+
+func (b *crdBuilder) structSchema(el transpiler.Struct) (apiextensionsv1.JSONSchemaProps, error) {
+	props := apiextensionsv1.JSONSchemaProps{
+		Type:       "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{},
+	}
+
+	for _, k := range sortedFieldNames(el.Fields) {
+		f := el.Fields[k]
+		p, err := b.fieldSchema(f)
+		if err != nil {
+			return props, err
+		}
+		props.Properties[f.JSONName] = p
+	}
+	// controller-gen omits the properties of structs without fields
+	if len(props.Properties) == 0 {
+		props.Properties = nil
+	}
+
+	for _, rule := range el.Rules {
+		props.XValidations = append(props.XValidations, apiextensionsv1.ValidationRule{
+			Rule:    rule.Rule,
+			Message: rule.Message,
+		})
+	}
+	if el.PreserveUnknownFields {
+		props.XPreserveUnknownFields = ptrTo(true)
+	}
+
+	return props, nil
+}
+
+// fieldSchema returns the schema of a field: the schema of its type, with
+// the keywords of the field markers.
+func (b *crdBuilder) fieldSchema(el transpiler.Field) (apiextensionsv1.JSONSchemaProps, error) {
+	props, err := b.typeSchema(el.Type)
+	if err != nil {
+		return props, fmt.Errorf("field %s: %w", el.Name, err)
+	}
+
+	// the field doc takes precedence over the doc of its type
+	if desc := docDescription(fieldComment(el)); len(desc) > 0 {
+		props.Description = desc
+	}
+
+	fieldKws, itemsKws, set := fieldKeywords(el)
+	if err := applyKeywords(&props, fieldKws); err != nil {
+		return props, err
+	}
+	if props.Items != nil && props.Items.Schema != nil {
+		if err := applyKeywords(props.Items.Schema, itemsKws); err != nil {
+			return props, err
+		}
+	}
+	if set {
+		props.XListType = ptrTo("set")
+	}
+	for _, rule := range fieldRules(el) {
+		props.XValidations = append(props.XValidations, apiextensionsv1.ValidationRule{
+			Rule:    rule.Rule,
+			Message: rule.Message,
+		})
+	}
+
+	if _, ok := defaultMarker(el); ok {
+		dat, err := json.Marshal(el.Default)
+		if err != nil {
+			return props, err
+		}
+		props.Default = &apiextensionsv1.JSON{Raw: dat}
+	}
+
+	if el.Nullable {
+		props.Nullable = true
+	}
+
+	return props, nil
+}
+
+// typeSchema returns the schema of a Go type of types.go.
+func (b *crdBuilder) typeSchema(typ string) (apiextensionsv1.JSONSchemaProps, error) {
+	typ = strings.TrimPrefix(typ, "*")
+
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		items, err := b.typeSchema(strings.TrimPrefix(typ, "[]"))
+		if err != nil {
+			return items, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &items},
+		}, nil
+
+	case strings.HasPrefix(typ, "map[string]"):
+		values, err := b.typeSchema(strings.TrimPrefix(typ, "map[string]"))
+		if err != nil {
+			return values, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &values},
+		}, nil
+	}
+
+	switch typ {
+	case "string":
+		return apiextensionsv1.JSONSchemaProps{Type: "string"}, nil
+	case "bool":
+		return apiextensionsv1.JSONSchemaProps{Type: "boolean"}, nil
+	case "int":
+		return apiextensionsv1.JSONSchemaProps{Type: "integer"}, nil
+	case "int32", "int64":
+		return apiextensionsv1.JSONSchemaProps{Type: "integer", Format: typ}, nil
+	case "float64":
+		return apiextensionsv1.JSONSchemaProps{Type: "number"}, nil
+	case typeTime:
+		return apiextensionsv1.JSONSchemaProps{Type: "string", Format: "date-time"}, nil
+	case typeJSON, typeInterface:
+		return apiextensionsv1.JSONSchemaProps{XPreserveUnknownFields: ptrTo(true)}, nil
+	case typeRawExtension:
+		return apiextensionsv1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: ptrTo(true)}, nil
+	}
+
+	el, ok := b.structs[typ]
+	if !ok {
+		return apiextensionsv1.JSONSchemaProps{}, fmt.Errorf("unknown type %s", typ)
+	}
+	for _, name := range b.visiting {
+		if name == typ {
+			return apiextensionsv1.JSONSchemaProps{}, fmt.Errorf("recursive type %s", typ)
+		}
+	}
+
+	b.visiting = append(b.visiting, typ)
+	defer func() { b.visiting = b.visiting[:len(b.visiting)-1] }()
+
+	return b.structSchema(el)
+}
+
+// applyKeywords sets the validation keywords on the schema.
+func applyKeywords(props *apiextensionsv1.JSONSchemaProps, kws []keyword) error {
+	for _, kw := range kws {
+		switch kw.Name {
+		case "Enum":
+			for _, el := range kw.Value.([]interface{}) {
+				dat, err := json.Marshal(el)
+				if err != nil {
+					return err
+				}
+				props.Enum = append(props.Enum, apiextensionsv1.JSON{Raw: dat})
+			}
+		case "Format":
+			props.Format = kw.Value.(string)
+		case "Pattern":
+			props.Pattern = kw.Value.(string)
+		case "MinLength":
+			props.MinLength = ptrTo(kw.Value.(int64))
+		case "MaxLength":
+			props.MaxLength = ptrTo(kw.Value.(int64))
+		case "Minimum":
+			props.Minimum = ptrTo(kw.Value.(float64))
+		case "Maximum":
+			props.Maximum = ptrTo(kw.Value.(float64))
+		case "ExclusiveMinimum":
+			props.ExclusiveMinimum = kw.Value.(bool)
+		case "ExclusiveMaximum":
+			props.ExclusiveMaximum = kw.Value.(bool)
+		case "MultipleOf":
+			props.MultipleOf = ptrTo(kw.Value.(float64))
+		case "MinItems":
+			props.MinItems = ptrTo(kw.Value.(int64))
+		case "MaxItems":
+			props.MaxItems = ptrTo(kw.Value.(int64))
+		default:
+			return fmt.Errorf("unsupported validation keyword %s", kw.Name)
+		}
+	}
+	return nil
+}
+
+// docDescription returns the description controller-gen extracts from a
+// comment rendered by jennifer: multi-line comments are block comments,
+// whose lines are joined in a single paragraph, single-line comments
+// starting with '+' are markers.
+func docDescription(comment string) string {
+	if len(comment) == 0 {
+		return ""
+	}
+	if !strings.Contains(comment, "\n") {
+		comment = strings.TrimSpace(comment)
+		if strings.HasPrefix(comment, "+") {
+			return ""
+		}
+		return comment
+	}
+
+	lines := []string{}
+	blank := false
+	for _, el := range strings.Split(comment, "\n") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			// leading blank lines are dropped, interior ones collapsed
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "\n")
+			blank = false
+		}
+		lines = append(lines, el)
+	}
+	return strings.Join(lines, " ")
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
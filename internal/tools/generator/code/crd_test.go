@@ -0,0 +1,185 @@
+package code
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/deployment"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/golden"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The golden CRD is the one controller-gen generates from types.go.golden,
+// as checked by TestBuildCRDMatchesControllerGen.
+func TestBuildCRD(t *testing.T) {
+	res := testResource(t)
+	res.PrinterColumns = []PrinterColumn{
+		{Name: "Name", JSONPath: ".spec.name"},
+		{Name: "Size", Type: "integer", JSONPath: ".spec.size", Priority: 1},
+	}
+
+	crd, warnings, err := BuildCRD(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected the warning about the settings field, got: %v", warnings)
+	}
+
+	dat, err := MarshalCRD(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, filepath.Join("testdata", "crd.yaml.golden"), dat)
+}
+
+func TestBuildCRDScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  apiextensionsv1.ResourceScope
+	}{
+		{"", apiextensionsv1.NamespaceScoped},
+		{"Namespaced", apiextensionsv1.NamespaceScoped},
+		{"Cluster", apiextensionsv1.ClusterScoped},
+	}
+
+	for _, tc := range tests {
+		res := testResource(t)
+		res.Scope = tc.scope
+
+		crd, _, err := BuildCRD(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crd.Spec.Scope != tc.want {
+			t.Errorf("scope %q: expected a %s CRD, got %s", tc.scope, tc.want, crd.Spec.Scope)
+		}
+
+		marker := resourceMarker(res)
+		if !strings.HasPrefix(marker, "+kubebuilder:resource:scope="+string(tc.want)) {
+			t.Errorf("scope %q: unexpected resource marker %s", tc.scope, marker)
+		}
+	}
+}
+
+func TestDocDescription(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"", ""},
+		{"Name: the name", "Name: the name"},
+		{"Name: +1 vote", "Name: +1 vote"},
+		{"Name: first line\nsecond line", "Name: first line second line"},
+		{"Name: first\n\n\nsecond  \n", "Name: first \n second"},
+	}
+
+	for _, tc := range tests {
+		if got := docDescription(tc.comment); got != tc.want {
+			t.Errorf("docDescription(%q): expected %q, got %q", tc.comment, tc.want, got)
+		}
+	}
+}
+
+func TestBuildCRDWithoutStatus(t *testing.T) {
+	res := testResource(t)
+	res.StatusSchema = nil
+
+	crd, _, err := BuildCRD(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["status"]
+	if status.Type != "object" || len(status.Properties) != 0 {
+		t.Errorf("expected an empty status, got %+v", status)
+	}
+}
+
+func TestBuildCRDPlural(t *testing.T) {
+	tests := []struct {
+		kind   string
+		plural string
+	}{
+		{"Repo", ""},
+		{"person", ""},
+		{"Repo", "Repositories"},
+	}
+
+	for _, tc := range tests {
+		res := testResource(t)
+		res.Kind, res.Plural = tc.kind, tc.plural
+
+		crd, _, err := BuildCRD(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gvr := deployment.ToGroupVersionResourceWithPlural(schema.GroupVersionKind{
+			Group:   res.Group,
+			Version: res.Version,
+			Kind:    tc.kind,
+		}, tc.plural)
+		if crd.Spec.Names.Plural != gvr.Resource {
+			t.Errorf("kind %s, plural %q: CRD plural %s differs from the resource %s of the controller",
+				tc.kind, tc.plural, crd.Spec.Names.Plural, gvr.Resource)
+		}
+		if !strings.Contains(resourceMarker(res), ",path="+gvr.Resource) {
+			t.Errorf("kind %s, plural %q: unexpected resource marker %s", tc.kind, tc.plural, resourceMarker(res))
+		}
+	}
+}
+
+func TestBuildCRDDecimalBounds(t *testing.T) {
+	res := testResource(t)
+	res.Schema = []byte(`{
+		"type": "object",
+		"properties": {
+			"ratio": {"type": "number", "minimum": 0.5, "maximum": 10, "exclusiveMaximum": true, "multipleOf": 0.5}
+		}
+	}`)
+
+	crd, _, err := BuildCRD(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratio := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["ratio"]
+	if ratio.Type != "string" {
+		t.Fatalf("expected a string-encoded decimal, got %s", ratio.Type)
+	}
+
+	want := []string{
+		"double(self) >= 0.5",
+		"double(self) < 10.0",
+		"double(self) / 0.5 >= 9007199254740992.0 || double(self) / 0.5 <= -9007199254740992.0 || " +
+			"(double(self) / 0.5 - double(int(double(self) / 0.5))) > -1e-9",
+	}
+	if len(ratio.XValidations) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), ratio.XValidations)
+	}
+	for i, el := range want {
+		if !strings.HasPrefix(ratio.XValidations[i].Rule, el) {
+			t.Errorf("expected rule %d to start with %q, got %q", i, el, ratio.XValidations[i].Rule)
+		}
+	}
+
+	// controller-gen must read the same rules from types.go
+	workdir := t.TempDir()
+	if _, err := CreateTypesDotGo(workdir, res); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(filepath.Join(workdir, "apis", "repo", "v1alpha1", "types.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, el := range ratio.XValidations {
+		marker := ruleMarker(transpiler.Rule{Rule: el.Rule, Message: el.Message})
+		if !strings.Contains(string(src), marker) {
+			t.Errorf("expected %s in types.go", marker)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package code
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler"
+)
+
+// defaultMarker returns the kubebuilder marker setting the default value
+// of the field. Defaults that do not match the field type are skipped,
+// since the API server would refuse the CRD.
+func defaultMarker(el transpiler.Field) (string, bool) {
+	if el.Default == nil || !isDefaultOfType(el.Default, el.Type) {
+		return "", false
+	}
+
+	val, ok := formatDefaultValue(el.Default)
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf("+kubebuilder:default=%s", val), true
+}
+
+func isDefaultOfType(val interface{}, typ string) bool {
+	typ = strings.TrimPrefix(typ, "*")
+
+	switch {
+	case typ == "string" || typ == typeTime:
+		_, ok := val.(string)
+		return ok
+	case typ == "bool":
+		_, ok := val.(bool)
+		return ok
+	case typ == "int" || typ == "int32" || typ == "int64":
+		v, ok := val.(float64)
+		return ok && v == math.Trunc(v)
+	case typ == "float64":
+		_, ok := val.(float64)
+		return ok
+	case strings.HasPrefix(typ, "[]"):
+		all, ok := val.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, el := range all {
+			if !isDefaultOfType(el, strings.TrimPrefix(typ, "[]")) {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(typ, "map[string]"):
+		all, ok := val.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, el := range all {
+			if !isDefaultOfType(el, strings.TrimPrefix(typ, "map[string]")) {
+				return false
+			}
+		}
+		return true
+	case typ == "interface{}":
+		return true
+	}
+
+	// generated struct
+	_, ok := val.(map[string]interface{})
+	return ok
+}
+
+// formatDefaultValue renders a JSON value with the marker syntax:
+// strings are quoted, arrays are {a,b} and objects are {"key": value}.
+// Empty objects are ambiguous with empty arrays, so they are not rendered.
+func formatDefaultValue(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, el := range v {
+			s, ok := formatDefaultValue(el)
+			if !ok {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return fmt.Sprintf("{%s}", strings.Join(items, ",")), true
+
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "", false
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, 0, len(v))
+		for _, k := range keys {
+			s, ok := formatDefaultValue(v[k])
+			if !ok {
+				return "", false
+			}
+			items = append(items, fmt.Sprintf("%s: %s", strconv.Quote(k), s))
+		}
+		return fmt.Sprintf("{%s}", strings.Join(items, ", ")), true
+	}
+
+	return formatMarkerValue(val)
+}
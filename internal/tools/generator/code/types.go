@@ -6,7 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"slices"
+	"sort"
 	"strings"
 
 	"github.com/dave/jennifer/jen"
@@ -16,46 +16,124 @@ import (
 )
 
 const (
-	pkgCommon           = "github.com/krateoplatformops/provider-runtime/apis/common/v1"
-	pkgCommonAlias      = "rtv1"
-	pkgMeta             = "k8s.io/apimachinery/pkg/apis/meta/v1"
-	pkgMetaAlias        = "metav1"
-	pkgSpecCommentFmt   = "%s defines the desired state of %s"
-	pkgStatusCommentFmt = "%s defines the observed state of %s"
+	pkgCommon             = "github.com/krateoplatformops/provider-runtime/apis/common/v1"
+	pkgCommonAlias        = "rtv1"
+	pkgMeta               = "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgMetaAlias          = "metav1"
+	pkgSpecCommentFmt     = "%s defines the desired state of %s"
+	pkgStatusCommentFmt   = "%s defines the observed state of %s"
+	pkgApiextensions      = "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	pkgApiextensionsAlias = "apiextensionsv1"
+	pkgRuntime            = "k8s.io/apimachinery/pkg/runtime"
+
+	typeInterface    = "interface{}"
+	typeJSON         = "apiextensionsv1.JSON"
+	typeRawExtension = "runtime.RawExtension"
+	typeTime         = "metav1.Time"
 )
 
-func isValidCRDDefinition(info map[string]transpiler.Struct) error {
-	invalidTypes := []string{"interface{}", "map[string]interface{}", "[]interface{}, map[interface{}]interface{}"}
-	for _, el := range info {
-		for _, f := range el.Fields {
-			if slices.Contains(invalidTypes, f.Type) {
-				return fmt.Errorf("invalid type %s for field %s", f.Type, f.Name)
+// qualifiedTypes maps the qualified field types to their import path.
+var qualifiedTypes = map[string]string{
+	typeJSON:         pkgApiextensions,
+	typeRawExtension: pkgRuntime,
+	typeTime:         pkgMeta,
+}
+
+// preserveUnknownFields replaces the free-form field types, which have no
+// structural schema, with types whose unknown fields are preserved by the
+// API server. It returns the paths of the affected fields and structs,
+// relative to the root struct (e.g. ".settings" or " (Settings)").
+func preserveUnknownFields(info map[string]transpiler.Struct) []string {
+	res := []string{}
+	for _, name := range sortedStructNames(info) {
+		prefix := fmt.Sprintf(" (%s)", name)
+		if name == "Root" {
+			prefix = ""
+		}
+
+		el := info[name]
+		if el.PreserveUnknownFields {
+			res = append(res, prefix)
+		}
+
+		for _, k := range sortedFieldNames(el.Fields) {
+			f := el.Fields[k]
+			typ, ok := freeFormType(f.Type)
+			if !ok {
+				continue
 			}
+
+			f.Type = typ
+			el.Fields[k] = f
+			res = append(res, fmt.Sprintf("%s.%s", prefix, f.JSONName))
 		}
 	}
-	return nil
+	return res
 }
 
-func CreateTypesDotGo(workdir string, res *Resource) error {
-	srcdir, err := createSourceDir(workdir, res)
-	if err != nil {
-		return err
+// moveReadOnlyFields removes the readOnly fields, which are assigned by the
+// remote API, from the spec structs. The top level ones are added to the
+// status instead.
+func moveReadOnlyFields(spec, status map[string]transpiler.Struct) {
+	for name, el := range spec {
+		for k, f := range el.Fields {
+			if !f.ReadOnly {
+				continue
+			}
+			delete(el.Fields, k)
+
+			root, ok := status["Root"]
+			if name != "Root" || !ok {
+				continue
+			}
+			if _, ok := root.Fields[k]; !ok {
+				f.Required, f.Optional = false, true
+				root.Fields[k] = f
+			}
+		}
 	}
+}
 
-	info, err := jsonschemaToStruct(bytes.NewReader(res.Schema))
-	if err != nil {
-		return err
+// removeWriteOnlyFields removes the writeOnly fields, such as secrets, from the status structs.
+func removeWriteOnlyFields(status map[string]transpiler.Struct) {
+	for _, el := range status {
+		for k, f := range el.Fields {
+			if f.WriteOnly {
+				delete(el.Fields, k)
+			}
+		}
 	}
-	if err := isValidCRDDefinition(info); err != nil {
-		return err
+}
+
+// freeFormType maps the interface{} based types to apiextensionsv1.JSON,
+// or to runtime.RawExtension for free-form objects. Single values are
+// pointers, so that unset fields are omitted instead of sent as null.
+func freeFormType(typ string) (string, bool) {
+	typ = strings.TrimPrefix(typ, "*")
+	if !strings.Contains(typ, typeInterface) {
+		return typ, false
+	}
+
+	switch typ {
+	case typeInterface:
+		return "*" + typeJSON, true
+	case "map[string]" + typeInterface:
+		return "*" + typeRawExtension, true
 	}
+	return strings.ReplaceAll(typ, typeInterface, typeJSON), true
+}
 
-	statusStruct, err := jsonschemaToStruct(bytes.NewReader(res.StatusSchema))
+// CreateTypesDotGo writes the Go types of the resource. It returns a
+// warning for each field whose unknown fields are preserved.
+func CreateTypesDotGo(workdir string, res *Resource) (warnings []string, err error) {
+	srcdir, err := createSourceDir(workdir, res)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := isValidCRDDefinition(statusStruct); err != nil {
-		return err
+
+	info, statusStruct, warnings, err := buildTypes(res)
+	if err != nil {
+		return nil, err
 	}
 
 	kind := text.ToGolangName(res.Kind)
@@ -63,9 +141,10 @@ func CreateTypesDotGo(workdir string, res *Resource) error {
 	g := jen.NewFile(normalizeVersion(res.Version))
 	g.ImportAlias(pkgCommon, pkgCommonAlias)
 	g.ImportAlias(pkgMeta, pkgMetaAlias)
+	g.ImportAlias(pkgApiextensions, pkgApiextensionsAlias)
 
-	for k, v := range info {
-		g.Add(renderStruct(k, v, res))
+	for _, k := range sortedStructNames(info) {
+		g.Add(renderStruct(k, info[k], res))
 	}
 
 	g.Add(jen.Line())
@@ -76,12 +155,9 @@ func CreateTypesDotGo(workdir string, res *Resource) error {
 
 	g.Add(jen.Comment("+kubebuilder:object:root=true"))
 	g.Add(jen.Comment("+kubebuilder:subresource:status"))
-	if len(res.Categories) > 0 {
-		g.Add(jen.Comment(
-			fmt.Sprintf("+kubebuilder:resource:scope=Namespaced,categories={%s}",
-				strings.Join(res.Categories, ","))))
-	} else {
-		g.Add(jen.Comment("+kubebuilder:resource:scope=Namespaced"))
+	g.Add(jen.Comment(resourceMarker(res)))
+	for _, col := range res.PrinterColumns {
+		g.Add(jen.Comment(printColumnMarker(col)))
 	}
 	g.Add(jen.Comment(`+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"`))
 	g.Add(jen.Comment(`+kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"`).Line())
@@ -107,11 +183,106 @@ func CreateTypesDotGo(workdir string, res *Resource) error {
 
 	src, err := os.Create(filepath.Join(srcdir, "types.go"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer src.Close()
 
-	return g.Render(src)
+	return warnings, g.Render(src)
+}
+
+// buildTypes transpiles the spec and status schemas of the resource to the
+// structs rendered in types.go, keyed by name. The root structs are "Root".
+func buildTypes(res *Resource) (info, statusStruct map[string]transpiler.Struct, warnings []string, err error) {
+	opts := transpiler.Options{MaxRecursionDepth: res.MaxRecursionDepth}
+
+	info, truncated, err := jsonschemaToStruct(bytes.NewReader(res.Schema), opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, el := range truncated {
+		warnings = append(warnings, fmt.Sprintf("recursive schema truncated in spec at %s", el))
+	}
+	for _, el := range preserveUnknownFields(info) {
+		warnings = append(warnings, fmt.Sprintf("unknown fields are preserved in spec%s", el))
+	}
+
+	// the kinds without a status schema, such as the authentication ones,
+	// get an empty status
+	statusStruct = map[string]transpiler.Struct{}
+	if len(res.StatusSchema) > 0 {
+		statusStruct, truncated, err = jsonschemaToStruct(bytes.NewReader(res.StatusSchema), opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, el := range truncated {
+			warnings = append(warnings, fmt.Sprintf("recursive schema truncated in status at %s", el))
+		}
+		for _, el := range preserveUnknownFields(statusStruct) {
+			warnings = append(warnings, fmt.Sprintf("unknown fields are preserved in status%s", el))
+		}
+	}
+
+	moveReadOnlyFields(info, statusStruct)
+	removeWriteOnlyFields(statusStruct)
+
+	return info, statusStruct, warnings, nil
+}
+
+// authRefFields returns the fields referencing the authentication
+// methods of the resource, sorted by name.
+func authRefFields(res *Resource) []transpiler.Field {
+	if res.AuthSchemas == nil {
+		return nil
+	}
+
+	fields := []transpiler.Field{}
+	for _, key := range sortedSchemaNames(*res.AuthSchemas) {
+		fields = append(fields, transpiler.Field{
+			Name:        fmt.Sprintf("%sAuthRef", text.ToGolangName(key)),
+			JSONName:    fmt.Sprintf("%sAuthRef", strings.ToLower(key)),
+			Type:        "string",
+			Optional:    true,
+			Description: fmt.Sprintf("Reference to %sAuth", text.ToGolangName(key)),
+		})
+	}
+	return fields
+}
+
+// plural returns the resource name of the CRD of res. The path of the
+// resource marker is always set, so that controller-gen, the CRD builder and
+// the RBAC of the controller agree on it.
+func plural(res *Resource) string {
+	return text.Plural(text.ToGolangName(res.Kind), res.Plural)
+}
+
+func resourceMarker(res *Resource) string {
+	marker := fmt.Sprintf("+kubebuilder:resource:scope=%s", resourceScope(res))
+	if len(res.Categories) > 0 {
+		marker = fmt.Sprintf("%s,categories={%s}", marker, strings.Join(res.Categories, ","))
+	}
+	marker = fmt.Sprintf("%s,path=%s", marker, plural(res))
+	if len(res.Singular) > 0 {
+		marker = fmt.Sprintf("%s,singular=%s", marker, res.Singular)
+	}
+	if len(res.ShortNames) > 0 {
+		marker = fmt.Sprintf("%s,shortName={%s}", marker, strings.Join(res.ShortNames, ","))
+	}
+	return marker
+}
+
+func printColumnMarker(col PrinterColumn) string {
+	typ := col.Type
+	if len(typ) == 0 {
+		typ = "string"
+	}
+
+	// controller-gen reads quoted arguments back with strconv.Unquote
+	marker := fmt.Sprintf(`+kubebuilder:printcolumn:name=%q,type=%q,JSONPath=%q`,
+		strings.ToUpper(col.Name), typ, col.JSONPath)
+	if col.Priority > 0 {
+		marker = fmt.Sprintf("%s,priority=%d", marker, col.Priority)
+	}
+	return marker
 }
 
 func renderStruct(key string, el transpiler.Struct, res *Resource) jen.Code {
@@ -127,53 +298,65 @@ func renderStruct(key string, el transpiler.Struct, res *Resource) jen.Code {
 				Tag(map[string]string{
 					"json": ",inline",
 				}).Line())
-		if res.AuthSchemas != nil {
-			for key := range *res.AuthSchemas {
-				authRefField := transpiler.Field{
-					Name:        fmt.Sprintf("%sAuthRef", text.ToGolangName(key)),
-					JSONName:    fmt.Sprintf("%sAuthRef", strings.ToLower(key)),
-					Type:        "string",
-					Optional:    true,
-					Description: fmt.Sprintf("Reference to %sAuth", text.ToGolangName(key)),
-				}
-				fields = append(fields, renderField(authRefField))
-			}
+		for _, f := range authRefFields(res) {
+			fields = append(fields, renderField(f))
 		}
 	}
 
-	for _, f := range el.Fields {
+	for _, k := range sortedFieldNames(el.Fields) {
 		// if f.Name == res.Identifier {
 		// 	continue
 		// }
-		fields = append(fields, renderField(f))
+		fields = append(fields, renderField(el.Fields[k]))
 	}
 
+	out := &jen.Statement{}
 	if root {
 		comment := fmt.Sprintf(pkgSpecCommentFmt, key, kind)
-		return jen.Comment(comment).Line().
-			Type().Id(key).Struct(fields...).
-			Line()
+		out.Add(jen.Comment(comment).Line())
+	}
+	for _, rule := range el.Rules {
+		out.Add(jen.Comment(ruleMarker(rule)).Line())
+	}
+	if el.PreserveUnknownFields {
+		out.Add(jen.Comment("+kubebuilder:pruning:PreserveUnknownFields").Line())
 	}
 
-	return jen.Type().Id(key).Struct(fields...).Line()
+	return out.Add(jen.Type().Id(key).Struct(fields...).Line())
 }
 
 func renderField(el transpiler.Field) jen.Code {
 	res := &jen.Statement{}
-	if len(el.Description) > 0 {
-		comment := fmt.Sprintf("%s: %s", el.Name, el.Description)
+	if comment := fieldComment(el); len(comment) > 0 {
 		res.Add(jen.Comment(comment).Line())
 	}
 
-	if el.Optional {
-		res.Add(jen.Comment("+optional").Line())
+	for _, marker := range validationMarkers(el) {
+		res.Add(jen.Comment(marker).Line())
+	}
+	for _, rule := range fieldRules(el) {
+		res.Add(jen.Comment(ruleMarker(rule)).Line())
+	}
+
+	if marker, ok := defaultMarker(el); ok {
+		res.Add(jen.Comment(marker).Line())
+	}
+
+	if el.Nullable {
+		res.Add(jen.Comment("+nullable").Line())
+	}
+
+	if el.Optional || el.Nullable {
+		if el.Optional {
+			res.Add(jen.Comment("+optional").Line())
+		}
 		if !strings.HasPrefix(el.Type, "*") {
-			res.Add(jen.Id(el.Name).Op("*").Id(el.Type))
+			res.Add(jen.Id(el.Name).Op("*").Add(typeCode(el.Type)))
 		} else {
-			res.Add(jen.Id(el.Name).Id(el.Type))
+			res.Add(jen.Id(el.Name).Add(typeCode(el.Type)))
 		}
 	} else {
-		res.Add(jen.Id(el.Name).Id(el.Type))
+		res.Add(jen.Id(el.Name).Add(typeCode(el.Type)))
 	}
 
 	res.Add(jen.Tag(map[string]string{
@@ -183,11 +366,19 @@ func renderField(el transpiler.Field) jen.Code {
 	return res
 }
 
+// fieldComment returns the doc comment of the field.
+func fieldComment(el transpiler.Field) string {
+	if len(el.Description) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", el.Name, el.Description)
+}
+
 func createStatusStruct(kind string, info map[string]transpiler.Struct, isManaged bool) jen.Code {
 	kind = text.ToGolangName(kind)
 	key := text.ToGolangName(fmt.Sprintf("%sStatus", kind))
 
-	root := info["Root"]
+	// root := info["Root"]
 	// var ideField *transpiler.Field
 	// for _, f := range root.Fields {
 	// 	if f.Name == identifier {
@@ -274,6 +465,50 @@ func createFailedObjectRef() jen.Code {
 	return jen.Type().Id("FailedObjectRef").Struct(fields...).Line()
 }
 
+// typeCode renders a field type, importing the packages of the qualified types.
+func typeCode(typ string) *jen.Statement {
+	switch {
+	case strings.HasPrefix(typ, "*"):
+		return jen.Op("*").Add(typeCode(strings.TrimPrefix(typ, "*")))
+	case strings.HasPrefix(typ, "[]"):
+		return jen.Index().Add(typeCode(strings.TrimPrefix(typ, "[]")))
+	case strings.HasPrefix(typ, "map[string]"):
+		return jen.Map(jen.String()).Add(typeCode(strings.TrimPrefix(typ, "map[string]")))
+	}
+
+	if pkg, ok := qualifiedTypes[typ]; ok {
+		return jen.Qual(pkg, typ[strings.Index(typ, ".")+1:])
+	}
+	return jen.Id(typ)
+}
+
+func sortedStructNames(m map[string]transpiler.Struct) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sortedFieldNames(m map[string]transpiler.Field) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sortedSchemaNames(m map[string][]byte) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
 func createSourceDir(workdir string, res *Resource) (string, error) {
 	srcdir := filepath.Join(workdir, "apis",
 		strings.ToLower(res.Kind),
@@ -282,11 +517,12 @@ func createSourceDir(workdir string, res *Resource) (string, error) {
 	return srcdir, err
 }
 
-func jsonschemaToStruct(r io.Reader) (map[string]transpiler.Struct, error) {
+func jsonschemaToStruct(r io.Reader, opts transpiler.Options) (map[string]transpiler.Struct, []string, error) {
 	schema, err := jsonschema.ParseReader(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return transpiler.Transpile(schema)
+	res, err := transpiler.TranspileWithOptions(opts, schema)
+	return res.Structs, res.Truncated, err
 }
@@ -0,0 +1,143 @@
+package code
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/golden"
+)
+
+func testResource(t *testing.T) *Resource {
+	t.Helper()
+	schema, err := os.ReadFile(filepath.Join("testdata", "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Resource{
+		Group:        "example.krateo.io",
+		Version:      "v1alpha1",
+		Kind:         "Repo",
+		Categories:   []string{"repo"},
+		Schema:       schema,
+		StatusSchema: []byte(`{"type": "object", "properties": {"id": {"type": "string"}, "createdAt": {"type": "string"}}}`),
+		AuthSchemas: &map[string][]byte{
+			"bearer": nil,
+			"basic":  nil,
+			"apiKey": nil,
+		},
+		IsManaged: true,
+	}
+}
+
+func TestCreateTypesDotGoIsDeterministic(t *testing.T) {
+	res := testResource(t)
+
+	goldenFile := filepath.Join("testdata", "types.go.golden")
+
+	var first []byte
+	for i := 0; i < 10; i++ {
+		workdir := t.TempDir()
+		if _, err := CreateTypesDotGo(workdir, res); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(workdir, "apis", "repo", "v1alpha1", "types.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first == nil {
+			first = got
+			continue
+		}
+		if !bytes.Equal(first, got) {
+			t.Fatalf("run %d produced a different types.go:\n%s\n\nfirst run:\n%s", i+1, got, first)
+		}
+	}
+
+	golden.Assert(t, goldenFile, first)
+}
+
+// parseMarkerArgs reads the arguments of a marker the way controller-gen
+// does: quoted values are unquoted with strconv.Unquote.
+func parseMarkerArgs(t *testing.T, marker, name string) map[string]string {
+	t.Helper()
+	prefix := name + ":"
+	if !strings.HasPrefix(marker, prefix) {
+		t.Fatalf("%s is not a %s marker", marker, name)
+	}
+
+	var sc scanner.Scanner
+	sc.Init(strings.NewReader(strings.TrimPrefix(marker, prefix)))
+	sc.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings | scanner.ScanRawStrings
+	sc.Error = func(_ *scanner.Scanner, msg string) { t.Fatalf("parsing %s: %s", marker, msg) }
+
+	res := map[string]string{}
+	for {
+		if tok := sc.Scan(); tok != scanner.Ident {
+			t.Fatalf("parsing %s: expected an argument name, got %q", marker, sc.TokenText())
+		}
+		key := sc.TokenText()
+		if sc.Scan() != '=' {
+			t.Fatalf("parsing %s: expected = after %s", marker, key)
+		}
+		switch sc.Scan() {
+		case scanner.String, scanner.RawString:
+			val, err := strconv.Unquote(sc.TokenText())
+			if err != nil {
+				t.Fatalf("parsing %s: %v", marker, err)
+			}
+			res[key] = val
+		case scanner.Int:
+			res[key] = sc.TokenText()
+		default:
+			t.Fatalf("parsing %s: unexpected value of %s: %q", marker, key, sc.TokenText())
+		}
+
+		switch sc.Scan() {
+		case scanner.EOF:
+			return res
+		case ',':
+		default:
+			t.Fatalf("parsing %s: unexpected %q after %s", marker, sc.TokenText(), key)
+		}
+	}
+}
+
+func TestPrintColumnMarker(t *testing.T) {
+	tests := []struct {
+		name string
+		col  PrinterColumn
+	}{
+		{"defaults", PrinterColumn{Name: "Name", JSONPath: ".spec.name"}},
+		{"priority", PrinterColumn{Name: "Size", Type: "integer", JSONPath: ".spec.size", Priority: 1}},
+		{"comma", PrinterColumn{Name: "Owner, Repo", JSONPath: ".spec.owner"}},
+		{"quote", PrinterColumn{Name: `The "id"`, JSONPath: ".status.id"}},
+		{"backslash", PrinterColumn{Name: `a\b`, JSONPath: ".spec.path"}},
+		{"filter", PrinterColumn{Name: "Ready", JSONPath: `.status.conditions[?(@.type=="Ready")].status`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			marker := printColumnMarker(tc.col)
+			got := parseMarkerArgs(t, marker, "+kubebuilder:printcolumn")
+
+			// The CRD builder must agree with the marker controller-gen reads.
+			want := printerColumns(&Resource{PrinterColumns: []PrinterColumn{tc.col}})[0]
+			priority := "0"
+			if p, ok := got["priority"]; ok {
+				priority = p
+			}
+			if got["name"] != want.Name || got["type"] != want.Type ||
+				got["JSONPath"] != want.JSONPath || priority != strconv.Itoa(int(want.Priority)) {
+				t.Errorf("marker %s parsed as %v, expected %+v", marker, got, want)
+			}
+		})
+	}
+}
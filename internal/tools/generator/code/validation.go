@@ -0,0 +1,257 @@
+package code
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler"
+)
+
+// knownFormats are the string formats validated by the API server, other
+// formats are not emitted.
+var knownFormats = map[string]bool{
+	"bsonobjectid": true, "uri": true, "email": true, "hostname": true,
+	"ipv4": true, "ipv6": true, "cidr": true, "mac": true,
+	"uuid": true, "uuid3": true, "uuid4": true, "uuid5": true,
+	"isbn": true, "isbn10": true, "isbn13": true, "creditcard": true,
+	"ssn": true, "hexcolor": true, "rgbcolor": true, "byte": true,
+	"password": true, "date": true, "duration": true, "datetime": true,
+	"date-time": true,
+}
+
+const (
+	markerValidation      = "+kubebuilder:validation:"
+	markerItemsValidation = "+kubebuilder:validation:items:"
+)
+
+// keyword is a validation keyword, named after its kubebuilder marker.
+type keyword struct {
+	Name  string
+	Value interface{}
+}
+
+// validationMarkers returns the kubebuilder markers enforcing the
+// validation keywords of the field. Keywords that do not apply to the
+// field type are skipped.
+func validationMarkers(el transpiler.Field) []string {
+	res := []string{}
+	fieldKws, itemsKws, set := fieldKeywords(el)
+	for _, kw := range fieldKws {
+		res = append(res, fmt.Sprintf("%s%s=%s", markerValidation, kw.Name, formatKeyword(kw)))
+	}
+	for _, kw := range itemsKws {
+		res = append(res, fmt.Sprintf("%s%s=%s", markerItemsValidation, kw.Name, formatKeyword(kw)))
+	}
+	if set {
+		res = append(res, "+listType=set")
+	}
+	return res
+}
+
+// fieldKeywords returns the validation keywords of the field and of its
+// items, and whether the field is a set list.
+func fieldKeywords(el transpiler.Field) (field []keyword, items []keyword, set bool) {
+	typ := strings.TrimPrefix(el.Type, "*")
+
+	field = typeKeywords(typ, el.Validation)
+
+	if strings.HasPrefix(typ, "[]") {
+		itemsTyp := strings.TrimPrefix(typ, "[]")
+		items = typeKeywords(itemsTyp, el.ItemsValidation)
+
+		// uniqueItems is not allowed in structural schemas,
+		// a set list is the closest equivalent.
+		set = el.Validation != nil && el.Validation.UniqueItems && isScalarType(itemsTyp)
+	}
+
+	return field, items, set
+}
+
+func typeKeywords(typ string, v *transpiler.Validation) []keyword {
+	if v.IsEmpty() {
+		return nil
+	}
+
+	res := []keyword{}
+	add := func(name string, value interface{}) {
+		res = append(res, keyword{Name: name, Value: value})
+	}
+
+	if len(v.Enum) > 0 && isScalarType(typ) {
+		ok := true
+		for _, el := range v.Enum {
+			_, valid := formatMarkerValue(el)
+			ok = ok && valid
+		}
+		if ok {
+			add("Enum", v.Enum)
+		}
+	}
+
+	switch {
+	case typ == "string":
+		if knownFormats[v.Format] {
+			add("Format", v.Format)
+		}
+		// the API server only accepts RE2 patterns
+		if len(v.Pattern) > 0 && !strings.Contains(v.Pattern, "`") {
+			if _, err := regexp.Compile(v.Pattern); err == nil {
+				add("Pattern", v.Pattern)
+			}
+		}
+		if v.MinLength != nil {
+			add("MinLength", *v.MinLength)
+		}
+		if v.MaxLength != nil {
+			add("MaxLength", *v.MaxLength)
+		}
+
+	case isNumericType(typ):
+		if v.Minimum != nil {
+			add("Minimum", *v.Minimum)
+			if v.ExclusiveMinimum {
+				add("ExclusiveMinimum", true)
+			}
+		}
+		if v.Maximum != nil {
+			add("Maximum", *v.Maximum)
+			if v.ExclusiveMaximum {
+				add("ExclusiveMaximum", true)
+			}
+		}
+		if v.MultipleOf != nil {
+			add("MultipleOf", *v.MultipleOf)
+		}
+
+	case strings.HasPrefix(typ, "[]"):
+		if v.MinItems != nil {
+			add("MinItems", *v.MinItems)
+		}
+		if v.MaxItems != nil {
+			add("MaxItems", *v.MaxItems)
+		}
+	}
+
+	return res
+}
+
+// formatKeyword renders the value of a keyword with the marker syntax.
+func formatKeyword(kw keyword) string {
+	switch v := kw.Value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, el := range v {
+			s, _ := formatMarkerValue(el)
+			values = append(values, s)
+		}
+		return strings.Join(values, ";")
+	case string:
+		if kw.Name == "Pattern" {
+			return fmt.Sprintf("`%s`", v)
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(kw.Value)
+}
+
+func isScalarType(typ string) bool {
+	return typ == "string" || typ == "bool" || isNumericType(typ)
+}
+
+func isNumericType(typ string) bool {
+	switch typ {
+	case "int", "int32", "int64", "float64":
+		return true
+	}
+	return false
+}
+
+func formatMarkerValue(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return strconv.Quote(v), true
+	case float64:
+		return formatNumber(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// fieldRules returns the CEL rules of the field. The numeric keywords of
+// string-encoded decimals are enforced by rules on their parsed value, as
+// the numeric markers do not apply to strings. Lists of decimals only keep
+// the decimal pattern of their items: a rule on every item of an unbounded
+// list would exceed the cost budget of the API server.
+func fieldRules(el transpiler.Field) []transpiler.Rule {
+	v := el.Validation
+	if strings.TrimPrefix(el.Type, "*") != "string" || v == nil || !v.Decimal {
+		return nil
+	}
+
+	res := []transpiler.Rule{}
+	if v.Minimum != nil {
+		op, msg := ">=", "greater than or equal to"
+		if v.ExclusiveMinimum {
+			op, msg = ">", "greater than"
+		}
+		res = append(res, transpiler.Rule{
+			Rule:    fmt.Sprintf("double(self) %s %s", op, celDouble(*v.Minimum)),
+			Message: fmt.Sprintf("must be %s %s", msg, formatNumber(*v.Minimum)),
+		})
+	}
+	if v.Maximum != nil {
+		op, msg := "<=", "less than or equal to"
+		if v.ExclusiveMaximum {
+			op, msg = "<", "less than"
+		}
+		res = append(res, transpiler.Rule{
+			Rule:    fmt.Sprintf("double(self) %s %s", op, celDouble(*v.Maximum)),
+			Message: fmt.Sprintf("must be %s %s", msg, formatNumber(*v.Maximum)),
+		})
+	}
+	if v.MultipleOf != nil && *v.MultipleOf > 0 {
+		// the fractional part of the quotient, tolerating rounding errors.
+		// From 2^53 on every double is whole: the quotient is only converted
+		// to an int below, where it cannot overflow.
+		q := fmt.Sprintf("double(self) / %s", celDouble(*v.MultipleOf))
+		whole := fmt.Sprintf("%s >= %s || %s <= -%s", q, celDouble(maxExactDouble), q, celDouble(maxExactDouble))
+		frac := fmt.Sprintf("(%s - double(int(%s)))", q, q)
+		res = append(res, transpiler.Rule{
+			Rule: fmt.Sprintf("%s || %s > -1e-9 && %s < 1e-9 || %s > 0.999999999 || %s < -0.999999999",
+				whole, frac, frac, frac, frac),
+			Message: fmt.Sprintf("must be a multiple of %s", formatNumber(*v.MultipleOf)),
+		})
+	}
+	return res
+}
+
+// maxExactDouble is 2^53, the doubles from which on are all whole numbers.
+const maxExactDouble = 1 << 53
+
+// celDouble renders v as a CEL double literal.
+func celDouble(v float64) string {
+	s := formatNumber(v)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func ruleMarker(rule transpiler.Rule) string {
+	return fmt.Sprintf("+kubebuilder:validation:XValidation:rule=%q,message=%q", rule.Rule, rule.Message)
+}
@@ -3,13 +3,9 @@ package generator
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/gobuffalo/flect"
@@ -23,8 +19,7 @@ import (
 )
 
 const (
-	tmpModPathFmt = "github.com/krateoplatformops/%s"
-	defaultGroup  = "composition.krateo.io"
+	defaultGroup = "composition.krateo.io"
 )
 
 type CRDGenerator interface {
@@ -103,100 +98,34 @@ func (g *defaultCRDGenerator) GVK() (schema.GroupVersionKind, error) {
 	}, nil
 }
 
+// Generate builds the CRD of the chart values schema in-process.
 func (g *defaultCRDGenerator) Generate(ctx context.Context) ([]byte, error) {
-	clean := len(os.Getenv("GEN_CLEAN_WORKDIR")) == 0
-
-	cfg, res, err := g.crdInfoFromChart()
-	if err != nil {
-		return nil, err
-	}
-	if clean {
-		defer os.RemoveAll(cfg.Workdir)
-	}
-	if err := code.Do(&res, cfg); err != nil {
-		return nil, err
-	}
-
-	cmd := exec.Command("go", "mod", "init", cfg.Module)
-	cmd.Dir = cfg.Workdir
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("%s: performing 'go mod init' (workdir: %s, module: %s, gvk: %s/%s,%s)",
-			err.Error(), cfg.Workdir, cfg.Module, res.Group, res.Version, res.Kind)
-	}
-
-	cmd = exec.Command("go", "mod", "tidy")
-	cmd.Dir = cfg.Workdir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		if len(out) > 0 {
-			return nil, fmt.Errorf("%s: performing 'go mod tidy' (workdir: %s, module: %s, gvk: %s/%s,%s)",
-				string(out), cfg.Workdir, cfg.Module, res.Group, res.Version, res.Kind)
-		}
-		return nil, fmt.Errorf("%s: performing 'go mod tidy' (workdir: %s, module: %s, gvk: %s/%s,%s)",
-			err.Error(), cfg.Workdir, cfg.Module, res.Group, res.Version, res.Kind)
-	}
-
-	cmd = exec.Command("go",
-		"run",
-		"--tags",
-		"generate",
-		"sigs.k8s.io/controller-tools/cmd/controller-gen",
-		"object:headerFile=./hack/boilerplate.go.txt",
-		"paths=./...", "crd:crdVersions=v1",
-		"output:artifacts:config=./crds",
-	)
-	cmd.Dir = cfg.Workdir
-	out, err = cmd.CombinedOutput()
-	if err != nil {
-		if len(out) > 0 {
-			return nil, fmt.Errorf("%s: performing 'go run --tags generate...' (workdir: %s, module: %s, gvk: %s/%s,%s)",
-				string(out), cfg.Workdir, cfg.Module, res.Group, res.Version, res.Kind)
-		}
-		return nil, fmt.Errorf("%s: performing 'go run --tags generate...' (workdir: %s, module: %s, gvk: %s/%s,%s)",
-			err.Error(), cfg.Workdir, cfg.Module, res.Group, res.Version, res.Kind)
-	}
-
-	fsys := os.DirFS(cfg.Workdir)
-	all, err := fs.ReadDir(fsys, "crds")
-	if err != nil {
-		return nil, err
-	}
-
-	fp, err := fsys.Open(filepath.Join("crds", all[0].Name()))
+	res, err := g.crdInfoFromChart()
 	if err != nil {
 		return nil, err
 	}
-	defer fp.Close()
 
-	dat, err := io.ReadAll(fp)
+	crd, _, err := code.BuildCRD(&res)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: generating CRD (gvk: %s/%s,%s)",
+			err.Error(), res.Group, res.Version, res.Kind)
 	}
 
-	return dat, nil
+	return code.MarshalCRD(crd)
 }
 
-func (g *defaultCRDGenerator) crdInfoFromChart() (opts code.Options, res code.Resource, err error) {
-	opts.Module = fmt.Sprintf(tmpModPathFmt, g.rootDir)
-	opts.Workdir = filepath.Join(os.TempDir(), opts.Module)
-	err = os.MkdirAll(opts.Workdir, os.ModePerm)
-	if err != nil {
-		if !errors.Is(err, os.ErrExist) {
-			return opts, res, err
-		}
-	}
-
+func (g *defaultCRDGenerator) crdInfoFromChart() (res code.Resource, err error) {
 	dat, err := g.valuesSchemaFromChart()
 	if err != nil {
-		return opts, res, err
+		return res, err
 	}
 
 	gvk, err := g.GVK()
 	if err != nil {
-		return opts, res, err
+		return res, err
 	}
 
-	return opts, code.Resource{
+	return code.Resource{
 		Group:      gvk.Group,
 		Version:    gvk.Version,
 		Kind:       gvk.Kind,
@@ -1,11 +1,16 @@
 package generator
 
 import (
-	"strings"
-
-	"github.com/gobuffalo/flect"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
 )
 
-func Plural(kind string) string {
-	return strings.ToLower(flect.Pluralize(kind))
+// Plural returns the lowercase pluralized kind, or the lowercase override
+// when one is specified.
+func Plural(kind string, override ...string) string {
+	for _, el := range override {
+		if len(el) > 0 {
+			return text.Plural(kind, el)
+		}
+	}
+	return text.Plural(kind, "")
 }
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/gobuffalo/flect"
 )
 
 func CapitaliseFirstLetter(s string) string {
@@ -64,3 +66,12 @@ func isNotAGoNameCharacter(r rune) bool {
 	}
 	return true
 }
+
+// Plural returns the resource name of kind: the lowercase override when
+// specified, the lowercase pluralized kind otherwise.
+func Plural(kind string, override string) string {
+	if len(override) > 0 {
+		return strings.ToLower(override)
+	}
+	return strings.ToLower(flect.Pluralize(kind))
+}
@@ -93,3 +93,21 @@ func TestThatJavascriptKeyNamesCanBeConvertedToValidGoNames(t *testing.T) {
 		}
 	}
 }
+
+func TestPlural(t *testing.T) {
+	tests := []struct {
+		kind     string
+		override string
+		want     string
+	}{
+		{kind: "Repo", want: "repoes"},
+		{kind: "ServiceEndpoint", want: "serviceendpoints"},
+		{kind: "Repo", override: "Repositories", want: "repositories"},
+	}
+
+	for _, tc := range tests {
+		if got := Plural(tc.kind, tc.override); got != tc.want {
+			t.Errorf("kind %s, override %q: expected %s, got %s", tc.kind, tc.override, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package transpiler
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler/jsonschema"
+)
+
+// Rule is a CEL validation rule enforced by the API server on a struct.
+type Rule struct {
+	Rule    string
+	Message string
+}
+
+var celIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// processAllOf merges the allOf sub-schemas and processes the result.
+func (g *transpiler) processAllOf(name string, schema *jsonschema.Schema) (string, error) {
+	merged := g.mergeAllOf(schema, map[*jsonschema.Schema]bool{})
+	merged.FixMissingTypeValue()
+
+	// cache the object name in case any sub-schemas recursively reference it
+	if typ, _ := merged.Type(); typ == "object" {
+		name = g.uniqueName(name, schema)
+		schema.GeneratedType = "*" + name
+	}
+
+	typ, err := g.processSchema(name, merged)
+	if err != nil {
+		return "", err
+	}
+	schema.GeneratedType = merged.GeneratedType
+	return typ, nil
+}
+
+// mergeAllOf returns a copy of schema that has the properties, the required
+// fields and the keywords of all its allOf sub-schemas. The oneOf/anyOf
+// sub-schemas of the members are not merged: they usually point back to
+// a base schema the member extends.
+func (g *transpiler) mergeAllOf(schema *jsonschema.Schema, seen map[*jsonschema.Schema]bool) *jsonschema.Schema {
+	seen[schema] = true
+
+	res := *schema
+	res.AllOf = nil
+	res.Properties = make(map[string]*jsonschema.Schema, len(schema.Properties))
+	for k, v := range schema.Properties {
+		res.Properties[k] = v
+	}
+	res.Required = append([]string{}, schema.Required...)
+
+	for _, el := range schema.AllOf {
+		el = g.resolveReference(el)
+		if seen[el] {
+			continue
+		}
+		if len(el.AllOf) > 0 {
+			el = g.mergeAllOf(el, seen)
+		}
+		seen[el] = true
+
+		for k, v := range el.Properties {
+			if _, ok := res.Properties[k]; !ok {
+				res.Properties[k] = v
+			}
+		}
+		for _, k := range el.Required {
+			if !contains(res.Required, k) {
+				res.Required = append(res.Required, k)
+			}
+		}
+
+		if res.TypeValue == nil {
+			res.TypeValue = el.TypeValue
+		}
+		if len(res.Description) == 0 {
+			res.Description = el.Description
+		}
+		if res.AdditionalProperties == nil {
+			res.AdditionalProperties = el.AdditionalProperties
+		}
+		if res.Items == nil {
+			res.Items = el.Items
+		}
+		if res.Default == nil {
+			res.Default = el.Default
+		}
+		if len(res.Enum) == 0 {
+			res.Enum = el.Enum
+		}
+		if len(res.Format) == 0 {
+			res.Format = el.Format
+		}
+		if len(res.Pattern) == 0 {
+			res.Pattern = el.Pattern
+		}
+	}
+
+	return &res
+}
+
+// processUnion processes a schema with oneOf or anyOf sub-schemas.
+//
+// When the schema has a discriminator, the sub-schemas are flattened in a
+// single struct whose discriminator property is restricted to the known
+// values, so the payload sent to the remote API is unchanged.
+//
+// When the sub-schemas only list required properties, the schema is
+// processed as a regular object with a rule enforcing the combination.
+//
+// Otherwise the result is a union struct with an optional field for each
+// sub-schema and a rule enforcing that exactly one (oneOf) or at least
+// one (anyOf) of them is set.
+func (g *transpiler) processUnion(name string, schema *jsonschema.Schema) (string, error) {
+	alts, exclusive := schema.OneOf, true
+	if len(alts) == 0 {
+		alts, exclusive = schema.AnyOf, false
+	}
+
+	base := *schema
+	base.OneOf, base.AnyOf, base.Discriminator = nil, nil, nil
+	// a union is always a struct, not a map
+	base.AdditionalProperties = nil
+
+	nonNull := []*jsonschema.Schema{}
+	for _, el := range alts {
+		if typ, multi := el.Type(); typ != "null" || multi {
+			nonNull = append(nonNull, el)
+		}
+	}
+
+	if schema.Discriminator != nil && len(schema.Discriminator.PropertyName) > 0 {
+		return g.processDiscriminated(name, schema, &base, nonNull)
+	}
+
+	if isConstraintOnly(nonNull) {
+		base.TypeValue = "object"
+		return g.processObjectWithRule(name, &base, requiredRule(nonNull, exclusive))
+	}
+
+	if len(nonNull) == 1 {
+		base.AllOf = append([]*jsonschema.Schema{nonNull[0]}, base.AllOf...)
+		return g.processAllOf(name, &base)
+	}
+
+	base.TypeValue = "object"
+	typ, err := g.processObject(name, &base)
+	if err != nil {
+		return "", err
+	}
+	schema.GeneratedType = typ
+
+	// the struct name may have been changed to avoid a clash
+	name = strings.TrimPrefix(typ, "*")
+	strct := g.Structs[name]
+	members := make([]string, 0, len(nonNull))
+	for i, el := range nonNull {
+		fieldName := g.unionMemberName(el, i)
+		for _, ok := strct.Fields[fieldName]; ok; _, ok = strct.Fields[fieldName] {
+			fieldName = fmt.Sprintf("%s%d", fieldName, i+1)
+		}
+
+		subName := g.getSchemaName(name+fieldName, el)
+		fieldType, err := g.processSchema(subName, el)
+		if err != nil {
+			return "", err
+		}
+
+		f := Field{
+			Name:        fieldName,
+			JSONName:    text.FirstToLower(fieldName),
+			Type:        fieldType,
+			Optional:    true,
+			Description: g.resolveReference(el).Description,
+			Validation:  g.getValidation(el),
+			Default:     g.getDefault(el),
+		}
+		if el.Items != nil {
+			f.ItemsValidation = g.getValidation(el.Items)
+		}
+		strct.Fields[f.Name] = f
+		members = append(members, fmt.Sprintf("has(self.%s)", f.JSONName))
+	}
+
+	strct.Rules = append(strct.Rules, unionRule(members, exclusive))
+	g.Structs[name] = strct
+
+	return typ, nil
+}
+
+// processDiscriminated flattens the sub-schemas of a discriminated union.
+func (g *transpiler) processDiscriminated(name string, schema, base *jsonschema.Schema, alts []*jsonschema.Schema) (string, error) {
+	prop := schema.Discriminator.PropertyName
+
+	values := []interface{}{}
+	if len(schema.Discriminator.Mapping) > 0 {
+		keys := make([]string, 0, len(schema.Discriminator.Mapping))
+		for k := range schema.Discriminator.Mapping {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, k)
+		}
+	}
+
+	base.AllOf = nil
+	base.Properties = make(map[string]*jsonschema.Schema, len(schema.Properties))
+	for k, v := range schema.Properties {
+		base.Properties[k] = v
+	}
+	base.Required = append([]string{}, schema.Required...)
+
+	for _, el := range alts {
+		if len(schema.Discriminator.Mapping) == 0 && len(el.Reference) > 0 {
+			values = append(values, path.Base(el.Reference))
+		}
+
+		merged := g.mergeAllOf(g.resolveReference(el), map[*jsonschema.Schema]bool{schema: true})
+		for k, v := range merged.Properties {
+			if _, ok := base.Properties[k]; !ok {
+				base.Properties[k] = v
+			}
+		}
+	}
+
+	if disc, ok := base.Properties[prop]; ok && len(values) > 0 {
+		cp := *disc
+		cp.Enum = values
+		base.Properties[prop] = &cp
+	}
+	if !contains(base.Required, prop) {
+		base.Required = append(base.Required, prop)
+	}
+
+	base.TypeValue = "object"
+	typ, err := g.processObject(name, base)
+	if err != nil {
+		return "", err
+	}
+	schema.GeneratedType = typ
+	return typ, nil
+}
+
+func (g *transpiler) processObjectWithRule(name string, schema *jsonschema.Schema, rule *Rule) (string, error) {
+	typ, err := g.processObject(name, schema)
+	if err != nil {
+		return "", err
+	}
+
+	name = strings.TrimPrefix(typ, "*")
+	if strct, ok := g.Structs[name]; ok && rule != nil {
+		strct.Rules = append(strct.Rules, *rule)
+		g.Structs[name] = strct
+	}
+	return typ, nil
+}
+
+// unionMemberName returns the field name of a union member: the name of
+// the referenced schema, its title, or its type.
+func (g *transpiler) unionMemberName(schema *jsonschema.Schema, idx int) string {
+	if len(schema.Reference) > 0 {
+		return text.ToGolangName(path.Base(schema.Reference))
+	}
+	if len(schema.Title) > 0 {
+		return text.ToGolangName(schema.Title)
+	}
+	if typ, _ := schema.Type(); len(typ) > 0 && typ != "object" {
+		return text.ToGolangName(typ)
+	}
+	return fmt.Sprintf("Option%d", idx+1)
+}
+
+// isConstraintOnly returns true if the sub-schemas only list required properties.
+func isConstraintOnly(alts []*jsonschema.Schema) bool {
+	if len(alts) == 0 {
+		return false
+	}
+	for _, el := range alts {
+		if len(el.Required) == 0 || el.TypeValue != nil || len(el.Properties) > 0 ||
+			len(el.Reference) > 0 || el.Items != nil || len(el.SubSchemas()) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func requiredRule(alts []*jsonschema.Schema, exclusive bool) *Rule {
+	members := make([]string, 0, len(alts))
+	for _, el := range alts {
+		checks := make([]string, 0, len(el.Required))
+		for _, k := range el.Required {
+			if !celIdentifier.MatchString(k) {
+				return nil
+			}
+			checks = append(checks, fmt.Sprintf("has(self.%s)", k))
+		}
+		members = append(members, strings.Join(checks, " && "))
+	}
+
+	rule := unionRule(members, exclusive)
+	return &rule
+}
+
+func unionRule(members []string, exclusive bool) Rule {
+	list := fmt.Sprintf("[%s]", strings.Join(members, ", "))
+	if exclusive {
+		return Rule{
+			Rule:    list + ".exists_one(x, x)",
+			Message: "exactly one of the alternatives must be set",
+		}
+	}
+	return Rule{
+		Rule:    list + ".exists(x, x)",
+		Message: "at least one of the alternatives must be set",
+	}
+}
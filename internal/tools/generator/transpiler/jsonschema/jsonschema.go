@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -43,16 +44,32 @@ type Schema struct {
 	// "additionalProperties": false
 	AdditionalPropertiesBool *bool `json:"-"`
 
+	// AnyOf, AllOf and OneOf combine sub-schemas.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.7
 	AnyOf []*Schema
 	AllOf []*Schema
 	OneOf []*Schema
 
+	// Discriminator is the OpenAPI hint telling which of the oneOf/anyOf
+	// sub-schemas an instance matches.
+	// https://spec.openapis.org/oas/v3.0.3#discriminator-object
+	Discriminator *Discriminator
+
 	// Default can be used to supply a default JSON value associated with a particular schema.
 	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.10.2
 	Default interface{}
 
 	Optional bool `json:"optional"`
 
+	// Nullable allows the null value (OpenAPI 3.0). From OpenAPI 3.1 "null" is listed in the type instead.
+	// https://spec.openapis.org/oas/v3.0.3#fixed-fields-19
+	Nullable bool `json:"nullable"`
+
+	// ReadOnly values are only returned by the server, WriteOnly values are only sent to it.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.10.3
+	ReadOnly  bool `json:"readOnly"`
+	WriteOnly bool `json:"writeOnly"`
+
 	// Examples ...
 	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.10.4
 	Examples []interface{}
@@ -65,6 +82,33 @@ type Schema struct {
 	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.4
 	Items *Schema
 
+	// Enum restricts the instance to a fixed set of values.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.1.2
+	Enum []interface{}
+
+	// Format, Pattern, MinLength and MaxLength validate strings.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.3
+	Format    string
+	Pattern   string
+	MinLength *int64
+	MaxLength *int64
+
+	// Minimum, Maximum and MultipleOf validate numbers. ExclusiveMinimum and
+	// ExclusiveMaximum are booleans up to draft-04 (and in OAS 3.0) and
+	// numbers from draft-06 onwards.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.2
+	Minimum          *float64
+	Maximum          *float64
+	ExclusiveMinimum interface{}
+	ExclusiveMaximum interface{}
+	MultipleOf       *float64
+
+	// MinItems, MaxItems and UniqueItems validate arrays.
+	// http://json-schema.org/draft-07/json-schema-validation.html#rfc.section.6.4
+	MinItems    *int64
+	MaxItems    *int64
+	UniqueItems bool
+
 	// NameCount is the number of times the instance name was encountered across the schema.
 	NameCount int `json:"-" `
 
@@ -81,6 +125,27 @@ type Schema struct {
 	GeneratedType string `json:"-"`
 }
 
+// Discriminator selects a sub-schema using the value of a property.
+type Discriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping"`
+}
+
+// SubSchemas returns the allOf, anyOf and oneOf sub-schemas keyed by their path element.
+func (schema *Schema) SubSchemas() map[string]*Schema {
+	res := map[string]*Schema{}
+	for i, el := range schema.AllOf {
+		res[fmt.Sprintf("allOf/%d", i)] = el
+	}
+	for i, el := range schema.AnyOf {
+		res[fmt.Sprintf("anyOf/%d", i)] = el
+	}
+	for i, el := range schema.OneOf {
+		res[fmt.Sprintf("oneOf/%d", i)] = el
+	}
+	return res
+}
+
 // UnmarshalJSON handles unmarshalling AdditionalProperties from JSON.
 func (ap *AdditionalProperties) UnmarshalJSON(data []byte) error {
 	var b bool
@@ -164,6 +229,28 @@ func (schema *Schema) MultiType() ([]string, bool) {
 	return nil, false
 }
 
+// IsNullable returns true if the schema allows the null value, either
+// with the nullable keyword, a "null" type or a "null" oneOf/anyOf alternative.
+func (schema *Schema) IsNullable() bool {
+	if schema.Nullable {
+		return true
+	}
+	types, _ := schema.MultiType()
+	for _, el := range types {
+		if el == "null" {
+			return true
+		}
+	}
+	for _, alts := range [][]*Schema{schema.OneOf, schema.AnyOf} {
+		for _, el := range alts {
+			if typ, multi := el.Type(); typ == "null" && !multi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetRoot returns the root schema.
 func (schema *Schema) GetRoot() *Schema {
 	if schema.Parent != nil {
@@ -223,6 +310,11 @@ func (schema *Schema) updatePathElements() {
 		schema.Items.PathElement = "items"
 		schema.Items.updatePathElements()
 	}
+
+	for k, el := range schema.SubSchemas() {
+		el.PathElement = k
+		el.updatePathElements()
+	}
 }
 
 func (schema *Schema) updateParentLinks() {
@@ -245,6 +337,10 @@ func (schema *Schema) updateParentLinks() {
 		schema.Items.Parent = schema
 		schema.Items.updateParentLinks()
 	}
+	for _, el := range schema.SubSchemas() {
+		el.Parent = schema
+		el.updateParentLinks()
+	}
 }
 
 func (schema *Schema) ensureSchemaKeyword() error {
@@ -274,6 +370,11 @@ func (schema *Schema) ensureSchemaKeyword() error {
 			return err
 		}
 	}
+	for k, el := range schema.SubSchemas() {
+		if err := check(k, el); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -115,3 +115,93 @@ func TestThatDefaultsCanBeParsed(t *testing.T) {
 		t.Errorf("expected default value of property 'name' type to be 'Enrique', but was '%v'", defaultValue)
 	}
 }
+
+func TestThatValidationKeywordsCanBeParsed(t *testing.T) {
+	s := `{
+        "type": "object",
+        "properties": {
+            "name": {
+                "type": "string",
+                "pattern": "^[a-z]+$",
+                "minLength": 1,
+                "maxLength": 63,
+                "format": "hostname"
+            },
+            "size": {
+                "type": "integer",
+                "minimum": 1,
+                "exclusiveMaximum": 100
+            },
+            "visibility": {
+                "type": "string",
+                "enum": ["public", "private"]
+            },
+            "tags": {
+                "type": "array",
+                "items": {"type": "string"},
+                "minItems": 1,
+                "uniqueItems": true
+            }
+        }
+    }`
+
+	so, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatal("It was not possible to unmarshal the schema:", err)
+	}
+
+	name := so.Properties["name"]
+	if name.Pattern != "^[a-z]+$" || name.Format != "hostname" {
+		t.Errorf("expected pattern and format of 'name' to be parsed, got %q and %q", name.Pattern, name.Format)
+	}
+	if name.MinLength == nil || *name.MinLength != 1 || name.MaxLength == nil || *name.MaxLength != 63 {
+		t.Errorf("expected minLength and maxLength of 'name' to be 1 and 63")
+	}
+
+	size := so.Properties["size"]
+	if size.Minimum == nil || *size.Minimum != 1 {
+		t.Errorf("expected minimum of 'size' to be 1")
+	}
+	if v, ok := size.ExclusiveMaximum.(float64); !ok || v != 100 {
+		t.Errorf("expected exclusiveMaximum of 'size' to be 100, but was %v", size.ExclusiveMaximum)
+	}
+
+	if got := len(so.Properties["visibility"].Enum); got != 2 {
+		t.Errorf("expected 2 enum values for 'visibility', but got %d", got)
+	}
+
+	tags := so.Properties["tags"]
+	if tags.MinItems == nil || *tags.MinItems != 1 || !tags.UniqueItems {
+		t.Errorf("expected minItems and uniqueItems of 'tags' to be parsed")
+	}
+}
+
+func TestThatRecursiveSchemasAreDetected(t *testing.T) {
+	s := `{
+        "definitions": {
+            "node": {
+                "type": "object",
+                "properties": {"children": {"type": "array", "items": {"$ref": "#/definitions/node"}}}
+            },
+            "a": {"type": "object", "properties": {"b": {"$ref": "#/definitions/b"}}},
+            "b": {"type": "object", "properties": {"a": {"$ref": "#/definitions/a"}}},
+            "leaf": {"type": "object", "properties": {"node": {"$ref": "#/definitions/node"}}}
+        }
+    }`
+
+	so, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatal("It was not possible to unmarshal the schema:", err)
+	}
+
+	r := NewRefResolver([]*Schema{so})
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]bool{"node": true, "a": true, "b": true, "leaf": false} {
+		if got := r.IsRecursive(so.Definitions[name]); got != expected {
+			t.Errorf("expected IsRecursive(%s) to be %v, but was %v", name, expected, got)
+		}
+	}
+}
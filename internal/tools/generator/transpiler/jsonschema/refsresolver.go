@@ -12,6 +12,8 @@ type RefResolver struct {
 	schemas []*Schema
 	//           k=uri     v=Schema
 	pathToSchema map[string]*Schema
+	// cache of IsRecursive results
+	recursive map[*Schema]bool
 }
 
 // NewRefResolver creates a reference resolver.
@@ -24,6 +26,7 @@ func NewRefResolver(schemas []*Schema) *RefResolver {
 // Init the resolver.
 func (r *RefResolver) Init() error {
 	r.pathToSchema = make(map[string]*Schema)
+	r.recursive = make(map[*Schema]bool)
 	for _, v := range r.schemas {
 		if err := r.mapPaths(v); err != nil {
 			return err
@@ -67,6 +70,56 @@ func (r *RefResolver) GetSchemaByReference(schema *Schema) (*Schema, error) {
 	return path, nil
 }
 
+// IsRecursive returns true if the schema refers to itself, directly or
+// through the references of its sub-schemas.
+func (r *RefResolver) IsRecursive(schema *Schema) bool {
+	if res, ok := r.recursive[schema]; ok {
+		return res
+	}
+
+	res := r.reaches(schema, schema, map[*Schema]bool{})
+	r.recursive[schema] = res
+	return res
+}
+
+// reaches returns true if target can be reached from schema following
+// sub-schemas and references.
+func (r *RefResolver) reaches(schema *Schema, target *Schema, seen map[*Schema]bool) bool {
+	if seen[schema] {
+		return false
+	}
+	seen[schema] = true
+
+	next := []*Schema{}
+	if schema.Reference != "" {
+		if ref, err := r.GetSchemaByReference(schema); err == nil {
+			if ref == target {
+				return true
+			}
+			next = append(next, ref)
+		}
+	}
+	for _, el := range schema.Properties {
+		next = append(next, el)
+	}
+	if schema.Items != nil {
+		next = append(next, schema.Items)
+	}
+	if schema.AdditionalProperties != nil {
+		next = append(next, (*Schema)(schema.AdditionalProperties))
+	}
+	for _, el := range schema.SubSchemas() {
+		next = append(next, el)
+	}
+
+	for _, el := range next {
+		if r.reaches(el, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *RefResolver) mapPaths(schema *Schema) error {
 	rootURI := &url.URL{}
 	id := schema.ID
@@ -150,6 +203,11 @@ func (r *RefResolver) updateURIs(schema *Schema, baseURI url.URL, checkCurrentID
 		newBaseURI.Fragment += "/items"
 		r.updateURIs(schema.Items, newBaseURI, true, ignoreFragments)
 	}
+	for k, subSchema := range schema.SubSchemas() {
+		newBaseURI := baseURI
+		newBaseURI.Fragment += "/" + k
+		r.updateURIs(subSchema, newBaseURI, true, ignoreFragments)
+	}
 	return nil
 }
 
@@ -3,6 +3,8 @@ package transpiler
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/text"
@@ -17,22 +19,59 @@ type transpiler struct {
 	Structs  map[string]Struct
 	Aliases  map[string]Field
 	// cache for reference types; k=url v=type
-	refs      map[string]string
-	anonCount int
+	refs map[string]string
+	// struct names in use; k=name v=path of the schema
+	names map[string]string
+	// schemas being processed, to detect recursion
+	stack    []*jsonschema.Schema
+	maxDepth int
+	// paths of the recursive references that have been cut
+	truncated []string
+}
+
+// DefaultMaxRecursionDepth is the default number of times a recursive schema is unrolled.
+const DefaultMaxRecursionDepth = 3
+
+// Options configures the transpiler.
+type Options struct {
+	// MaxRecursionDepth is the number of times a recursive schema is
+	// nested in itself before its recursive references are cut and
+	// replaced by free-form values. Defaults to DefaultMaxRecursionDepth.
+	MaxRecursionDepth int
+}
+
+// Result holds the structs produced from the JSON schemas.
+type Result struct {
+	Structs map[string]Struct
+	// Truncated lists the paths of the recursive references that have been cut.
+	Truncated []string
 }
 
 // Transpile creates an instance of a generator which will produce structs.
 func Transpile(schemas ...*jsonschema.Schema) (map[string]Struct, error) {
+	res, err := TranspileWithOptions(Options{}, schemas...)
+	return res.Structs, err
+}
+
+// TranspileWithOptions is like Transpile but also reports the recursive
+// references that have been cut.
+func TranspileWithOptions(opts Options, schemas ...*jsonschema.Schema) (Result, error) {
+	if opts.MaxRecursionDepth <= 0 {
+		opts.MaxRecursionDepth = DefaultMaxRecursionDepth
+	}
+
 	res := &transpiler{
 		schemas:  schemas,
 		resolver: jsonschema.NewRefResolver(schemas),
 		Structs:  make(map[string]Struct),
 		Aliases:  make(map[string]Field),
 		refs:     make(map[string]string),
+		names:    make(map[string]string),
+		maxDepth: opts.MaxRecursionDepth,
 	}
 	err := res.createStructs()
 
-	return res.Structs, err
+	return Result{Structs: res.Structs, Truncated: res.truncated}, err
 }
 
 // createStructs creates types from the JSON schemas, keyed by the golang name.
@@ -44,7 +83,7 @@ func (g *transpiler) createStructs() (err error) {
 	// extract the types
 	for _, schema := range g.schemas {
 		name := g.getSchemaName("", schema)
-		rootType, err := g.processSchema(name, schema)
+		rootType, err := g.processNested(name, schema)
 		if err != nil {
 			return err
 		}
@@ -70,8 +109,8 @@ func (g *transpiler) createStructs() (err error) {
 
 // process a block of definitions
 func (g *transpiler) processDefinitions(schema *jsonschema.Schema) error {
-	for key, subSchema := range schema.Definitions {
-		_, err := g.processSchema(text.ToGolangName(key), subSchema)
+	for _, key := range sortedKeys(schema.Definitions) {
+		_, err := g.processNested(text.ToGolangName(key), schema.Definitions[key])
 		// if val == "interface{}" || val == "[]interface{}" {
 		// 	fmt.Println("skipping interface{} type")
 		// 	continue
@@ -93,10 +132,13 @@ func (g *transpiler) processReference(schema *jsonschema.Schema) (string, error)
 	if err != nil {
 		return "", errors.New("processReference: reference \"" + schema.Reference + "\" not found at \"" + schemaPath + "\"")
 	}
+	if depth := g.depth(refSchema); depth > 0 && g.resolver.IsRecursive(refSchema) {
+		return g.processRecursiveReference(schema, refSchema, depth)
+	}
 	if refSchema.GeneratedType == "" {
 		// reference is not resolved yet. Do that now.
 		refSchemaName := g.getSchemaName("", refSchema)
-		typeName, err := g.processSchema(refSchemaName, refSchema)
+		typeName, err := g.processNested(refSchemaName, refSchema)
 		if err != nil {
 			return "", err
 		}
@@ -105,15 +147,64 @@ func (g *transpiler) processReference(schema *jsonschema.Schema) (string, error)
 	return refSchema.GeneratedType, nil
 }
 
+// processRecursiveReference unrolls a reference to a schema that is being
+// processed: the schema is generated again with a numbered name, so that
+// the resulting types are not recursive, since CRD schemas cannot be.
+// Past the maximum depth the reference is cut and becomes a free-form value.
+func (g *transpiler) processRecursiveReference(schema *jsonschema.Schema, refSchema *jsonschema.Schema, depth int) (string, error) {
+	if depth >= g.maxDepth {
+		// non-object schemas are not cached and may be processed more than once
+		if path := g.resolver.GetPath(schema); !contains(g.truncated, path) {
+			g.truncated = append(g.truncated, path)
+		}
+		return "interface{}", nil
+	}
+
+	saved := refSchema.GeneratedType
+	defer func() { refSchema.GeneratedType = saved }()
+
+	refSchema.GeneratedType = ""
+	refSchemaName := fmt.Sprintf("%s%d", g.getSchemaName("", refSchema), depth+1)
+	return g.processNested(refSchemaName, refSchema)
+}
+
+// processNested processes schema keeping track of the schemas being processed.
+func (g *transpiler) processNested(name string, schema *jsonschema.Schema) (string, error) {
+	g.stack = append(g.stack, schema)
+	defer func() { g.stack = g.stack[:len(g.stack)-1] }()
+
+	return g.processSchema(name, schema)
+}
+
+// depth returns how many times schema is being processed.
+func (g *transpiler) depth(schema *jsonschema.Schema) int {
+	res := 0
+	for _, el := range g.stack {
+		if el == schema {
+			res++
+		}
+	}
+	return res
+}
+
 // returns the type refered to by schema after resolving all dependencies
 func (g *transpiler) processSchema(schemaName string, schema *jsonschema.Schema) (typ string, err error) {
 	if len(schema.Definitions) > 0 {
 		g.processDefinitions(schema)
 	}
+	if len(schema.AllOf) > 0 {
+		return g.processAllOf(schemaName, schema)
+	}
+	if len(schema.OneOf) > 0 || len(schema.AnyOf) > 0 {
+		return g.processUnion(schemaName, schema)
+	}
 	schema.FixMissingTypeValue()
 	// if we have multiple schema types, the golang type will be interface{}
 	typ = "interface{}"
-	types, isMultiType := schema.MultiType()
+	types, _ := schema.MultiType()
+	// "null" only makes the field nullable (see jsonschema.IsNullable)
+	types = slices.DeleteFunc(types, func(el string) bool { return el == "null" })
+	isMultiType := len(types) > 1
 	if len(types) > 0 {
 		for _, schemaType := range types {
 			name := schemaName
@@ -138,7 +229,7 @@ func (g *transpiler) processSchema(schemaName string, schema *jsonschema.Schema)
 					return rv, nil
 				}
 			default:
-				rv, err := getPrimitiveTypeName(schemaType, "", false)
+				rv, err := getFormattedTypeName(schemaType, schema.Format)
 				if err != nil {
 					return "", err
 				}
@@ -191,6 +282,7 @@ func (g *transpiler) processArray(name string, schema *jsonschema.Schema) (typeS
 // schema: detail incl properties & child objects
 // returns: generated type
 func (g *transpiler) processObject(name string, schema *jsonschema.Schema) (typ string, err error) {
+	name = g.uniqueName(name, schema)
 	strct := Struct{
 		Name:        name,
 		Description: schema.Description,
@@ -199,7 +291,8 @@ func (g *transpiler) processObject(name string, schema *jsonschema.Schema) (typ
 	// cache the object name in case any sub-schemas recursively reference it
 	schema.GeneratedType = "*" + name
 	// regular properties
-	for propKey, prop := range schema.Properties {
+	for _, propKey := range sortedKeys(schema.Properties) {
+		prop := schema.Properties[propKey]
 		fieldName := text.ToGolangName(propKey)
 		// calculate sub-schema name here, may not actually be used depending on type of schema!
 		subSchemaName := g.getSchemaName(fieldName, prop)
@@ -215,6 +308,14 @@ func (g *transpiler) processObject(name string, schema *jsonschema.Schema) (typ
 			Required:    contains(schema.Required, propKey),
 			Optional:    prop.Optional, // TODO
 			Description: prop.Description,
+			Validation:  g.getValidation(prop),
+			Default:     g.getDefault(prop),
+			Nullable:    prop.IsNullable() || g.resolveReference(prop).IsNullable(),
+			ReadOnly:    prop.ReadOnly || g.resolveReference(prop).ReadOnly,
+			WriteOnly:   prop.WriteOnly || g.resolveReference(prop).WriteOnly,
+		}
+		if prop.Items != nil {
+			f.ItemsValidation = g.getValidation(prop.Items)
 		}
 		if f.Required {
 			strct.GenerateCode = true
@@ -239,6 +340,7 @@ func (g *transpiler) processObject(name string, schema *jsonschema.Schema) (typ
 		if len(schema.Properties) == 0 && !isDefinitionObject {
 			// since there are no regular properties, we don't need to emit a struct for this object - return the
 			// additionalProperties map type.
+			g.releaseName(name, schema)
 			return mapTyp, nil
 		}
 		// this struct will have both regular and additional properties
@@ -258,29 +360,23 @@ func (g *transpiler) processObject(name string, schema *jsonschema.Schema) (typ
 	// additionalProperties as either true (everything) or false (nothing)
 	if schema.AdditionalProperties != nil && schema.AdditionalProperties.AdditionalPropertiesBool != nil {
 		if *schema.AdditionalProperties.AdditionalPropertiesBool {
-			// everything is valid additional
-			subTyp := "map[string]interface{}"
-			f := Field{
-				Name:        "AdditionalProperties",
-				JSONName:    "-",
-				Type:        subTyp,
-				Required:    false,
-				Optional:    true,
-				Description: "",
+			// everything is valid additional: without regular properties this is a free-form map,
+			// otherwise the struct keeps the unknown fields next to the known ones.
+			isDefinitionObject := strings.HasPrefix(schema.PathElement, "definitions")
+			if len(schema.Properties) == 0 && !isDefinitionObject {
+				g.releaseName(name, schema)
+				return "map[string]interface{}", nil
 			}
-			strct.Fields[f.Name] = f
-			// setting this will cause marshal code to be emitted in Output()
 			strct.GenerateCode = true
 			strct.AdditionalType = "interface{}"
+			strct.PreserveUnknownFields = true
 		} else {
 			// nothing
 			strct.GenerateCode = true
 			strct.AdditionalType = "false"
 		}
 	}
-	if strct.AdditionalType != "interface{}" {
-		g.Structs[strct.Name] = strct
-	}
+	g.Structs[strct.Name] = strct
 
 	// objects are always a pointer
 	return getPrimitiveTypeName("object", name, true)
@@ -326,6 +422,29 @@ func getPrimitiveTypeName(schemaType string, subType string, pointer bool) (name
 		schemaType, subType)
 }
 
+// getFormattedTypeName returns the golang type of a primitive schema type
+// taking its format into account. Numbers are string-encoded decimals,
+// since floats are not portable in CRDs.
+func getFormattedTypeName(schemaType string, format string) (string, error) {
+	switch schemaType {
+	case "integer":
+		switch format {
+		case "int32":
+			return "int32", nil
+		case "int64":
+			return "int64", nil
+		}
+	case "number":
+		return "string", nil
+	case "string":
+		if format == "date-time" {
+			return "metav1.Time", nil
+		}
+	}
+
+	return getPrimitiveTypeName(schemaType, "", false)
+}
+
 // return a name for this (sub-)schema.
 func (g *transpiler) getSchemaName(keyName string, schema *jsonschema.Schema) string {
 	if len(schema.Title) > 0 {
@@ -343,8 +462,68 @@ func (g *transpiler) getSchemaName(keyName string, schema *jsonschema.Schema) st
 	if schema.Parent != nil && schema.Parent.JSONKey != "" {
 		return text.ToGolangName(schema.Parent.JSONKey + "Item")
 	}
-	g.anonCount++
-	return fmt.Sprintf("Anonymous%d", g.anonCount)
+	return g.pathName(schema)
+}
+
+// uniqueName returns name, unless it is the name of the struct of another
+// schema: in that case a name derived from the path of schema is returned.
+// Schemas are identified by their path, since copies of a schema (e.g. the
+// merged allOf sub-schemas) keep the path of the original.
+func (g *transpiler) uniqueName(name string, schema *jsonschema.Schema) string {
+	path := g.resolver.GetPath(schema)
+	if owner, ok := g.names[name]; !ok || owner == path {
+		g.names[name] = path
+		return name
+	}
+
+	base := g.pathName(schema)
+	res := base
+	for i := 2; ; i++ {
+		if owner, ok := g.names[res]; !ok || owner == path {
+			break
+		}
+		res = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[res] = path
+	return res
+}
+
+// releaseName frees the name reserved by uniqueName for a schema that
+// does not produce a struct.
+func (g *transpiler) releaseName(name string, schema *jsonschema.Schema) {
+	if _, ok := g.Structs[name]; !ok && g.names[name] == g.resolver.GetPath(schema) {
+		delete(g.names, name)
+	}
+}
+
+// pathName returns a name derived from the path of schema in the document,
+// e.g. "#/properties/spec/items/properties/config" becomes "SpecItemsConfig".
+func (g *transpiler) pathName(schema *jsonschema.Schema) string {
+	res := ""
+	for _, el := range strings.Split(g.resolver.GetPath(schema), "/") {
+		switch el {
+		case "#", "", "properties", "definitions":
+			continue
+		case "additionalProperties":
+			el = "Values"
+		}
+		res += text.ToGolangName(el)
+	}
+	if len(res) == 0 {
+		return "Root"
+	}
+	return res
+}
+
+// sortedKeys returns the keys of m in lexical order, so that schemas are
+// always processed in the same order and get the same names.
+func sortedKeys[V any](m map[string]V) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
 }
 
 // Struct defines the data required to generate a struct in Go.
@@ -359,6 +538,10 @@ type Struct struct {
 
 	GenerateCode   bool
 	AdditionalType string
+	// Rules are the CEL validation rules of the struct, if any.
+	Rules []Rule
+	// PreserveUnknownFields is set when the struct accepts any additional property.
+	PreserveUnknownFields bool
 }
 
 // Field defines the data required to generate a field in Go.
@@ -375,4 +558,16 @@ type Field struct {
 	// Optional
 	Optional    bool
 	Description string
+	// Validation holds the validation keywords of the field schema, if any.
+	Validation *Validation
+	// ItemsValidation holds the validation keywords of the items of an array field, if any.
+	ItemsValidation *Validation
+	// Default is the value used by the API server when the field is omitted, if any.
+	Default interface{}
+	// Nullable is set when the field accepts the null value.
+	Nullable bool
+	// ReadOnly is set when the field is only returned by the remote API.
+	ReadOnly bool
+	// WriteOnly is set when the field is only sent to the remote API.
+	WriteOnly bool
 }
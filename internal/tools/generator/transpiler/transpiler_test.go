@@ -3,6 +3,7 @@ package transpiler
 import (
 	"encoding/json"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -589,3 +590,433 @@ func TestThatUnmarshallingIsPossible(t *testing.T) {
 type Root struct {
 	Name interface{} `json:"name,omitempty"`
 }
+
+func TestValidationKeywordsAreCarriedToFields(t *testing.T) {
+	minLength := int64(3)
+	minimum := float64(0)
+	minItems := int64(1)
+
+	root := &jsonschema.Schema{
+		Title:     "Example",
+		TypeValue: "object",
+		Definitions: map[string]*jsonschema.Schema{
+			"visibility": {TypeValue: "string", Enum: []interface{}{"public", "private"}},
+		},
+		Properties: map[string]*jsonschema.Schema{
+			"name":       {TypeValue: "string", MinLength: &minLength, Pattern: "^[a-z]+$"},
+			"count":      {TypeValue: "integer", Minimum: &minimum, ExclusiveMinimum: true},
+			"visibility": {Reference: "#/definitions/visibility"},
+			"tags": {
+				TypeValue: "array",
+				MinItems:  &minItems,
+				Items:     &jsonschema.Schema{TypeValue: "string", Enum: []interface{}{"a", "b"}},
+			},
+			"plain": {TypeValue: "string"},
+		},
+	}
+	root.Init()
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+
+	name := fields["Name"].Validation
+	if name == nil || name.MinLength == nil || *name.MinLength != 3 || name.Pattern != "^[a-z]+$" {
+		t.Errorf("expected minLength and pattern on Name, got %+v", name)
+	}
+
+	count := fields["Count"].Validation
+	if count == nil || count.Minimum == nil || !count.ExclusiveMinimum {
+		t.Errorf("expected exclusive minimum on Count, got %+v", count)
+	}
+
+	visibility := fields["Visibility"].Validation
+	if visibility == nil || len(visibility.Enum) != 2 {
+		t.Errorf("expected the enum of the referenced schema on Visibility, got %+v", visibility)
+	}
+
+	tags := fields["Tags"]
+	if tags.Validation == nil || tags.Validation.MinItems == nil || *tags.Validation.MinItems != 1 {
+		t.Errorf("expected minItems on Tags, got %+v", tags.Validation)
+	}
+	if tags.ItemsValidation == nil || len(tags.ItemsValidation.Enum) != 2 {
+		t.Errorf("expected the items enum on Tags, got %+v", tags.ItemsValidation)
+	}
+
+	if fields["Plain"].Validation != nil {
+		t.Errorf("expected no validation on Plain, got %+v", fields["Plain"].Validation)
+	}
+}
+
+func TestDefaultsAreCarriedToFields(t *testing.T) {
+	root := &jsonschema.Schema{
+		Title:     "Example",
+		TypeValue: "object",
+		Definitions: map[string]*jsonschema.Schema{
+			"visibility": {TypeValue: "string", Default: "private"},
+		},
+		Properties: map[string]*jsonschema.Schema{
+			"size":       {TypeValue: "integer", Default: float64(10)},
+			"visibility": {Reference: "#/definitions/visibility"},
+			"tags":       {TypeValue: "array", Items: &jsonschema.Schema{TypeValue: "string"}, Default: []interface{}{"a"}},
+			"plain":      {TypeValue: "string"},
+		},
+	}
+	root.Init()
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+	if fields["Size"].Default != float64(10) {
+		t.Errorf("expected default 10 on Size, got %v", fields["Size"].Default)
+	}
+	if fields["Visibility"].Default != "private" {
+		t.Errorf("expected the default of the referenced schema on Visibility, got %v", fields["Visibility"].Default)
+	}
+	if v, ok := fields["Tags"].Default.([]interface{}); !ok || len(v) != 1 {
+		t.Errorf("expected an array default on Tags, got %v", fields["Tags"].Default)
+	}
+	if fields["Plain"].Default != nil {
+		t.Errorf("expected no default on Plain, got %v", fields["Plain"].Default)
+	}
+}
+
+func TestAllOfIsMergedInOneStruct(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"definitions": {
+			"base": {
+				"type": "object",
+				"properties": {"id": {"type": "string"}},
+				"required": ["id"]
+			}
+		},
+		"allOf": [
+			{"$ref": "#/definitions/base"},
+			{"type": "object", "properties": {"name": {"type": "string"}}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+	testField(fields["Id"], "id", "Id", "string", true, t)
+	testField(fields["Name"], "name", "Name", "string", false, t)
+}
+
+func TestOneOfBecomesAUnionStruct(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"definitions": {
+			"cat": {"type": "object", "properties": {"lives": {"type": "integer"}}}
+		},
+		"properties": {
+			"pet": {
+				"oneOf": [
+					{"$ref": "#/definitions/cat"},
+					{"type": "string"},
+					{"type": "null"}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	testField(results["Example"].Fields["Pet"], "pet", "Pet", "*Pet", false, t)
+
+	pet, ok := results["Pet"]
+	if !ok {
+		t.Fatalf("expected the Pet union struct, but only types %s were made", strings.Join(getStructNamesFromMap(results), ", "))
+	}
+	testField(pet.Fields["Cat"], "cat", "Cat", "*Cat", false, t)
+	testField(pet.Fields["String"], "string", "String", "string", false, t)
+
+	if len(pet.Rules) != 1 || pet.Rules[0].Rule != "[has(self.cat), has(self.string)].exists_one(x, x)" {
+		t.Errorf("expected an exactly one rule on Pet, got %+v", pet.Rules)
+	}
+}
+
+func TestAnyOfOfRequiredPropertiesBecomesARule(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"properties": {"a": {"type": "string"}, "b": {"type": "string"}},
+		"anyOf": [{"required": ["a"]}, {"required": ["b"]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	example := results["Example"]
+	if len(example.Fields) != 2 {
+		t.Errorf("expected 2 fields, got %d", len(example.Fields))
+	}
+	if len(example.Rules) != 1 || example.Rules[0].Rule != "[has(self.a), has(self.b)].exists(x, x)" {
+		t.Errorf("expected an at least one rule on Example, got %+v", example.Rules)
+	}
+}
+
+func TestDiscriminatedOneOfIsFlattened(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"definitions": {
+			"cat": {
+				"type": "object",
+				"properties": {"kind": {"type": "string"}, "lives": {"type": "integer"}}
+			},
+			"dog": {
+				"type": "object",
+				"properties": {"kind": {"type": "string"}, "barks": {"type": "boolean"}}
+			}
+		},
+		"oneOf": [
+			{"$ref": "#/definitions/cat"},
+			{"$ref": "#/definitions/dog"}
+		],
+		"discriminator": {"propertyName": "kind"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+	testField(fields["Kind"], "kind", "Kind", "string", true, t)
+	testField(fields["Lives"], "lives", "Lives", "int", false, t)
+	testField(fields["Barks"], "barks", "Barks", "bool", false, t)
+
+	if v := fields["Kind"].Validation; v == nil || len(v.Enum) != 2 || v.Enum[0] != "cat" || v.Enum[1] != "dog" {
+		t.Errorf("expected the discriminator to be restricted to cat and dog, got %+v", v)
+	}
+}
+
+func TestAdditionalPropertiesTrue(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"properties": {
+			"labels": {"type": "object", "additionalProperties": true},
+			"settings": {
+				"type": "object",
+				"properties": {"name": {"type": "string"}},
+				"additionalProperties": true
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	testField(results["Example"].Fields["Labels"], "labels", "Labels", "map[string]interface{}", false, t)
+	testField(results["Example"].Fields["Settings"], "settings", "Settings", "*Settings", false, t)
+
+	settings, ok := results["Settings"]
+	if !ok {
+		t.Fatalf("expected the Settings struct, but only types %s were made", strings.Join(getStructNamesFromMap(results), ", "))
+	}
+	if !settings.PreserveUnknownFields {
+		t.Errorf("expected Settings to preserve unknown fields")
+	}
+	if _, ok := settings.Fields["AdditionalProperties"]; ok {
+		t.Errorf("expected no AdditionalProperties field on Settings")
+	}
+}
+
+func TestFormatAwareTypes(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"properties": {
+			"count": {"type": "integer"},
+			"small": {"type": "integer", "format": "int32"},
+			"id": {"type": "integer", "format": "int64"},
+			"ratio": {"type": "number", "format": "double", "enum": [0.5, 1], "default": 0.5},
+			"createdAt": {"type": "string", "format": "date-time"},
+			"email": {"type": "string", "format": "email"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+	testField(fields["Count"], "count", "Count", "int", false, t)
+	testField(fields["Small"], "small", "Small", "int32", false, t)
+	testField(fields["Id"], "id", "Id", "int64", false, t)
+	testField(fields["Ratio"], "ratio", "Ratio", "string", false, t)
+	testField(fields["CreatedAt"], "createdAt", "CreatedAt", "metav1.Time", false, t)
+	testField(fields["Email"], "email", "Email", "string", false, t)
+
+	ratio := fields["Ratio"]
+	if ratio.Validation == nil || ratio.Validation.Pattern != decimalPattern || ratio.Validation.Format != "" {
+		t.Errorf("expected the decimal pattern on Ratio, got %+v", ratio.Validation)
+	}
+	if !reflect.DeepEqual(ratio.Validation.Enum, []interface{}{"0.5", "1"}) {
+		t.Errorf("expected a string-encoded enum on Ratio, got %v", ratio.Validation.Enum)
+	}
+	if ratio.Default != "0.5" {
+		t.Errorf("expected a string-encoded default on Ratio, got %v", ratio.Default)
+	}
+
+	if v := fields["Email"].Validation; v == nil || v.Format != "email" {
+		t.Errorf("expected the email format on Email, got %+v", v)
+	}
+}
+
+func TestNullableReadOnlyAndWriteOnlyFields(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer", "readOnly": true},
+			"password": {"type": "string", "writeOnly": true},
+			"nickname": {"type": "string", "nullable": true},
+			"bio": {"type": ["string", "null"]},
+			"name": {"type": "string"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Transpile(root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	fields := results["Example"].Fields
+	if !fields["Id"].ReadOnly {
+		t.Errorf("expected Id to be readOnly")
+	}
+	if !fields["Password"].WriteOnly {
+		t.Errorf("expected Password to be writeOnly")
+	}
+	if !fields["Nickname"].Nullable {
+		t.Errorf("expected Nickname to be nullable")
+	}
+	testField(fields["Bio"], "bio", "Bio", "string", false, t)
+	if !fields["Bio"].Nullable {
+		t.Errorf("expected Bio to be nullable")
+	}
+	if f := fields["Name"]; f.Nullable || f.ReadOnly || f.WriteOnly {
+		t.Errorf("expected Name to be a plain field, got %+v", f)
+	}
+}
+
+func TestRecursiveSchemasAreUnrolledAndTruncated(t *testing.T) {
+	root, err := jsonschema.Parse([]byte(`{
+		"title": "Example",
+		"type": "object",
+		"definitions": {
+			"comment": {
+				"type": "object",
+				"properties": {
+					"text": {"type": "string"},
+					"replies": {"type": "array", "items": {"$ref": "#/definitions/comment"}}
+				}
+			},
+			"tree": {"type": "array", "items": {"$ref": "#/definitions/tree"}}
+		},
+		"properties": {
+			"comment": {"$ref": "#/definitions/comment"},
+			"tree": {"$ref": "#/definitions/tree"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := TranspileWithOptions(Options{MaxRecursionDepth: 2}, root)
+	if err != nil {
+		t.Fatal("Failed to create structs: ", err)
+	}
+
+	testField(res.Structs["Example"].Fields["Comment"], "comment", "Comment", "*Comment", false, t)
+	testField(res.Structs["Comment"].Fields["Replies"], "replies", "Replies", "[]*Comment2", false, t)
+	testField(res.Structs["Comment2"].Fields["Replies"], "replies", "Replies", "[]interface{}", false, t)
+	testField(res.Structs["Example"].Fields["Tree"], "tree", "Tree", "[][]interface{}", false, t)
+
+	expected := []string{
+		"#/definitions/comment/properties/replies/items",
+		"#/definitions/tree/items",
+	}
+	sort.Strings(res.Truncated)
+	if !reflect.DeepEqual(res.Truncated, expected) {
+		t.Errorf("expected the truncated paths %v, got %v", expected, res.Truncated)
+	}
+}
+
+func TestClashingInlineNamesAreDerivedFromThePath(t *testing.T) {
+	s := `{
+		"type": "object",
+		"properties": {
+			"owner": {"type": "object", "properties": {"config": {"type": "object", "properties": {"email": {"type": "string"}}}}},
+			"config": {"type": "object", "properties": {"config": {"type": "object", "properties": {"depth": {"type": "integer"}}}}}
+		}
+	}`
+	for i := 0; i < 10; i++ {
+		// the schema is parsed at each run, since generated types are cached in it
+		so, err := jsonschema.Parse([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := Transpile(so)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0, len(results))
+		for k := range results {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != "Config,ConfigConfig,Owner,OwnerConfig,Root" {
+			t.Fatalf("unexpected structs: %s", got)
+		}
+		if typ := results["Config"].Fields["Config"].Type; typ != "*ConfigConfig" {
+			t.Errorf("expected the nested config to be *ConfigConfig, got %s", typ)
+		}
+		if typ := results["Owner"].Fields["Config"].Type; typ != "*OwnerConfig" {
+			t.Errorf("expected the owner config to be *OwnerConfig, got %s", typ)
+		}
+	}
+}
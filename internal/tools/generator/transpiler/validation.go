@@ -0,0 +1,137 @@
+package transpiler
+
+import (
+	"strconv"
+
+	"github.com/matteogastaldello/swaggergen-provider/internal/tools/generator/transpiler/jsonschema"
+)
+
+// decimalPattern validates the string-encoded decimals generated for numbers.
+const decimalPattern = `^[-+]?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`
+
+// Validation holds the validation keywords of a field schema.
+type Validation struct {
+	Enum             []interface{}
+	Format           string
+	Pattern          string
+	MinLength        *int64
+	MaxLength        *int64
+	Minimum          *float64
+	Maximum          *float64
+	ExclusiveMinimum bool
+	ExclusiveMaximum bool
+	MultipleOf       *float64
+	MinItems         *int64
+	MaxItems         *int64
+	UniqueItems      bool
+	// Decimal is set on the string-encoded decimals of number schemas, whose
+	// numeric keywords cannot be enforced by the numeric markers.
+	Decimal bool
+}
+
+// IsEmpty returns true if no validation keyword is set.
+func (v *Validation) IsEmpty() bool {
+	return v == nil || (len(v.Enum) == 0 && len(v.Format) == 0 && len(v.Pattern) == 0 &&
+		v.MinLength == nil && v.MaxLength == nil &&
+		v.Minimum == nil && v.Maximum == nil && v.MultipleOf == nil &&
+		v.MinItems == nil && v.MaxItems == nil && !v.UniqueItems)
+}
+
+// getValidation collects the validation keywords of schema, following
+// its reference when the schema is only a pointer to another one.
+func (g *transpiler) getValidation(schema *jsonschema.Schema) *Validation {
+	if schema == nil {
+		return nil
+	}
+
+	schema = g.resolveReference(schema)
+
+	res := &Validation{
+		Enum:        schema.Enum,
+		Format:      schema.Format,
+		Pattern:     schema.Pattern,
+		MinLength:   schema.MinLength,
+		MaxLength:   schema.MaxLength,
+		Minimum:     schema.Minimum,
+		Maximum:     schema.Maximum,
+		MultipleOf:  schema.MultipleOf,
+		MinItems:    schema.MinItems,
+		MaxItems:    schema.MaxItems,
+		UniqueItems: schema.UniqueItems,
+	}
+
+	// up to draft-04 (and OAS 3.0) exclusiveMinimum is a boolean modifier
+	// of minimum, from draft-06 onwards it is the bound itself.
+	switch v := schema.ExclusiveMinimum.(type) {
+	case bool:
+		res.ExclusiveMinimum = v && res.Minimum != nil
+	case float64:
+		res.Minimum, res.ExclusiveMinimum = &v, true
+	}
+
+	switch v := schema.ExclusiveMaximum.(type) {
+	case bool:
+		res.ExclusiveMaximum = v && res.Maximum != nil
+	case float64:
+		res.Maximum, res.ExclusiveMaximum = &v, true
+	}
+
+	// numbers are string-encoded decimals (see getFormattedTypeName)
+	if isNumber(schema) {
+		res.Decimal = true
+		res.Format = ""
+		if len(res.Pattern) == 0 {
+			res.Pattern = decimalPattern
+		}
+		res.Enum = make([]interface{}, len(schema.Enum))
+		for i, el := range schema.Enum {
+			res.Enum[i] = decimalString(el)
+		}
+	}
+
+	if res.IsEmpty() {
+		return nil
+	}
+	return res
+}
+
+// getDefault returns the default value of schema, following its
+// reference when the schema is only a pointer to another one.
+func (g *transpiler) getDefault(schema *jsonschema.Schema) interface{} {
+	if schema == nil {
+		return nil
+	}
+	if schema.Default == nil {
+		schema = g.resolveReference(schema)
+	}
+	if isNumber(schema) {
+		return decimalString(schema.Default)
+	}
+	return schema.Default
+}
+
+func isNumber(schema *jsonschema.Schema) bool {
+	typ, multi := schema.Type()
+	return typ == "number" && !multi
+}
+
+// decimalString encodes a number as a string-encoded decimal.
+func decimalString(val interface{}) interface{} {
+	if v, ok := val.(float64); ok {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return val
+}
+
+// resolveReference returns the schema referenced by schema, or schema
+// itself if it is not a reference or the reference cannot be resolved.
+func (g *transpiler) resolveReference(schema *jsonschema.Schema) *jsonschema.Schema {
+	if schema.Reference == "" {
+		return schema
+	}
+	ref, err := g.resolver.GetSchemaByReference(schema)
+	if err != nil || ref == nil {
+		return schema
+	}
+	return ref
+}
@@ -0,0 +1,35 @@
+// Package golden compares the output of the tests with the files in their
+// testdata directories. Run the tests with -update to regenerate the files.
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Assert fails t when got differs from the content of the golden file; with
+// -update it writes got to the golden file first.
+func Assert(t testing.TB, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("output differs from %s (run with -update to regenerate):\n%s", golden, got)
+	}
+}
@@ -0,0 +1,244 @@
+package schemadiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// Severity classifies how a schema change affects the existing objects.
+type Severity string
+
+const (
+	// None means that the schemas are equivalent.
+	None Severity = "None"
+	// Additive changes are safe: existing objects are still valid (e.g. a new optional field).
+	Additive Severity = "Additive"
+	// Risky changes keep the stored objects readable but may alter
+	// their behaviour or make them invalid on the next update
+	// (e.g. a new required field or a changed default).
+	Risky Severity = "Risky"
+	// Breaking changes make the stored objects invalid or unreadable
+	// (e.g. a removed field, a type change or a narrowed enum).
+	Breaking Severity = "Breaking"
+)
+
+var severityRank = map[Severity]int{
+	None:     0,
+	Additive: 1,
+	Risky:    2,
+	Breaking: 3,
+}
+
+// Change describes a single difference between two schemas.
+type Change struct {
+	Path     string
+	Severity Severity
+	Message  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s (%s)", c.Path, c.Message, c.Severity)
+}
+
+// Report is the list of changes between two schemas.
+type Report struct {
+	Changes []Change
+}
+
+// Severity returns the highest severity among the changes.
+func (r Report) Severity() Severity {
+	res := None
+	for _, el := range r.Changes {
+		if severityRank[el.Severity] > severityRank[res] {
+			res = el.Severity
+		}
+	}
+	return res
+}
+
+// Filter returns the changes of the given severity.
+func (r Report) Filter(sev Severity) []Change {
+	res := []Change{}
+	for _, el := range r.Changes {
+		if el.Severity == sev {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+func (r *Report) add(path string, sev Severity, format string, args ...any) {
+	r.Changes = append(r.Changes, Change{
+		Path:     path,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// CompareCRDs compares each version of newObj with the matching version
+// of oldObj or, for versions that oldObj does not define, with the storage
+// version of oldObj (the version the existing objects are stored with).
+// Stored versions of oldObj missing from newObj are breaking changes.
+func CompareCRDs(oldObj, newObj *apiextensionsv1.CustomResourceDefinition) Report {
+	res := Report{}
+
+	for _, el := range oldObj.Status.StoredVersions {
+		if findVersion(newObj, el) == nil {
+			res.add(el, Breaking, "stored version has been removed")
+		}
+	}
+
+	for _, ver := range newObj.Spec.Versions {
+		prev := findVersion(oldObj, ver.Name)
+		if prev == nil {
+			prev = storageVersion(oldObj)
+		}
+		if prev == nil || prev.Schema == nil || ver.Schema == nil {
+			continue
+		}
+
+		compare(&res, ver.Name, prev.Schema.OpenAPIV3Schema, ver.Schema.OpenAPIV3Schema)
+	}
+
+	return res
+}
+
+// Compare returns the changes needed to go from oldSchema to newSchema.
+func Compare(oldSchema, newSchema *apiextensionsv1.JSONSchemaProps) Report {
+	res := Report{}
+	compare(&res, "", oldSchema, newSchema)
+	return res
+}
+
+func compare(res *Report, path string, oldSchema, newSchema *apiextensionsv1.JSONSchemaProps) {
+	if oldSchema == nil || newSchema == nil {
+		return
+	}
+
+	if oldSchema.Type != newSchema.Type {
+		res.add(path, Breaking, "type changed from %q to %q", oldSchema.Type, newSchema.Type)
+		return
+	}
+
+	if !reflect.DeepEqual(oldSchema.Default, newSchema.Default) {
+		res.add(path, Risky, "default value changed")
+	}
+
+	compareEnums(res, path, oldSchema.Enum, newSchema.Enum)
+
+	for _, k := range sortedKeys(oldSchema.Properties) {
+		oldProp := oldSchema.Properties[k]
+		newProp, ok := newSchema.Properties[k]
+		if !ok {
+			res.add(join(path, k), Breaking, "field has been removed")
+			continue
+		}
+
+		if !contains(oldSchema.Required, k) && contains(newSchema.Required, k) {
+			res.add(join(path, k), Risky, "field became required")
+		}
+
+		compare(res, join(path, k), &oldProp, &newProp)
+	}
+
+	for _, k := range sortedKeys(newSchema.Properties) {
+		if _, ok := oldSchema.Properties[k]; ok {
+			continue
+		}
+
+		if contains(newSchema.Required, k) {
+			res.add(join(path, k), Risky, "new required field")
+		} else {
+			res.add(join(path, k), Additive, "new optional field")
+		}
+	}
+
+	if oldSchema.Items != nil && newSchema.Items != nil {
+		compare(res, path+"[*]", oldSchema.Items.Schema, newSchema.Items.Schema)
+	}
+
+	if oldSchema.AdditionalProperties != nil && newSchema.AdditionalProperties != nil {
+		compare(res, path+"[*]", oldSchema.AdditionalProperties.Schema, newSchema.AdditionalProperties.Schema)
+	}
+}
+
+func compareEnums(res *Report, path string, oldEnum, newEnum []apiextensionsv1.JSON) {
+	if len(newEnum) == 0 {
+		if len(oldEnum) > 0 {
+			res.add(path, Additive, "enum constraint removed")
+		}
+		return
+	}
+
+	if len(oldEnum) == 0 {
+		res.add(path, Breaking, "enum constraint added")
+		return
+	}
+
+	for _, el := range oldEnum {
+		if !containsJSON(newEnum, el) {
+			res.add(path, Breaking, "enum value %s has been removed", string(el.Raw))
+		}
+	}
+
+	for _, el := range newEnum {
+		if !containsJSON(oldEnum, el) {
+			res.add(path, Additive, "enum value %s has been added", string(el.Raw))
+		}
+	}
+}
+
+func findVersion(obj *apiextensionsv1.CustomResourceDefinition, name string) *apiextensionsv1.CustomResourceDefinitionVersion {
+	for i := range obj.Spec.Versions {
+		if obj.Spec.Versions[i].Name == name {
+			return &obj.Spec.Versions[i]
+		}
+	}
+	return nil
+}
+
+func storageVersion(obj *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinitionVersion {
+	for i := range obj.Spec.Versions {
+		if obj.Spec.Versions[i].Storage {
+			return &obj.Spec.Versions[i]
+		}
+	}
+	return nil
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys(m map[string]apiextensionsv1.JSONSchemaProps) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(all []string, s string) bool {
+	for _, el := range all {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsJSON(all []apiextensionsv1.JSON, s apiextensionsv1.JSON) bool {
+	for _, el := range all {
+		if string(el.Raw) == string(s.Raw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package schemadiff
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func enum(values ...string) []apiextensionsv1.JSON {
+	res := make([]apiextensionsv1.JSON, 0, len(values))
+	for _, el := range values {
+		res = append(res, apiextensionsv1.JSON{Raw: []byte(`"` + el + `"`)})
+	}
+	return res
+}
+
+func TestCompare(t *testing.T) {
+	oldSchema := &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name":       {Type: "string"},
+			"visibility": {Type: "string", Enum: enum("public", "private", "internal")},
+			"size":       {Type: "integer"},
+			"archived":   {Type: "boolean", Default: &apiextensionsv1.JSON{Raw: []byte("false")}},
+			"topics":     {Type: "array", Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}}},
+		},
+	}
+
+	newSchema := &apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"owner", "name"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name":        {Type: "string"},
+			"visibility":  {Type: "string", Enum: enum("public", "private")},
+			"size":        {Type: "string"},
+			"archived":    {Type: "boolean", Default: &apiextensionsv1.JSON{Raw: []byte("true")}},
+			"description": {Type: "string"},
+			"owner":       {Type: "string"},
+		},
+	}
+
+	report := Compare(oldSchema, newSchema)
+
+	expected := map[string]Severity{
+		"name":        Risky,
+		"visibility":  Breaking,
+		"size":        Breaking,
+		"archived":    Risky,
+		"topics":      Breaking,
+		"description": Additive,
+		"owner":       Risky,
+	}
+
+	got := map[string]Severity{}
+	for _, el := range report.Changes {
+		got[el.Path] = el.Severity
+	}
+
+	for path, sev := range expected {
+		if got[path] != sev {
+			t.Errorf("%s: expected %s, got %q", path, sev, got[path])
+		}
+	}
+
+	if len(got) != len(expected) {
+		t.Errorf("expected %d changed paths, got %v", len(expected), report.Changes)
+	}
+
+	if report.Severity() != Breaking {
+		t.Errorf("expected report severity %s, got %s", Breaking, report.Severity())
+	}
+}
+
+func TestCompareEquivalent(t *testing.T) {
+	schema := &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"name": {Type: "string", Enum: enum("a", "b")},
+		},
+	}
+
+	report := Compare(schema, schema.DeepCopy())
+	if len(report.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", report.Changes)
+	}
+	if report.Severity() != None {
+		t.Errorf("expected severity %s, got %s", None, report.Severity())
+	}
+}
+
+func TestCompareCRDsNewVersion(t *testing.T) {
+	schema := func(props map[string]apiextensionsv1.JSONSchemaProps) *apiextensionsv1.CustomResourceValidation {
+		return &apiextensionsv1.CustomResourceValidation{
+			OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: props},
+		}
+	}
+
+	oldObj := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Storage: true, Schema: schema(map[string]apiextensionsv1.JSONSchemaProps{
+					"name": {Type: "string"},
+				})},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1"}},
+	}
+
+	newObj := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1", Storage: true, Schema: schema(map[string]apiextensionsv1.JSONSchemaProps{
+					"fullName": {Type: "string"},
+				})},
+			},
+		},
+	}
+
+	report := CompareCRDs(oldObj, newObj)
+
+	breaking := report.Filter(Breaking)
+	if len(breaking) != 2 {
+		t.Fatalf("expected 2 breaking changes, got %v", report.Changes)
+	}
+	if breaking[0].Path != "v1alpha1" || breaking[1].Path != "v1beta1.name" {
+		t.Errorf("unexpected breaking changes: %v", breaking)
+	}
+	if additive := report.Filter(Additive); len(additive) != 1 || additive[0].Path != "v1beta1.fullName" {
+		t.Errorf("unexpected additive changes: %v", additive)
+	}
+}
@@ -0,0 +1,495 @@
+package specfetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	fgetter "github.com/hashicorp/go-getter"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMaxFiles = 256
+	maxFileSize     = 32 << 20
+	// maxRedirects is the limit of the default http.Client.
+	maxRedirects = 10
+)
+
+// archiveExtensions are the bundle formats supported by Fetch.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"}
+
+// Options configures Fetch.
+type Options struct {
+	// AllowedHosts are the hosts remote references may be fetched from,
+	// besides the host of the specification itself.
+	AllowedHosts []string
+	// Client is the HTTP client used to fetch remote files.
+	// Defaults to http.DefaultClient.
+	Client *http.Client
+	// MaxFiles bounds the number of fetched files. Defaults to 256.
+	MaxFiles int
+}
+
+// Reason classifies the failures of Fetch.
+type Reason string
+
+const (
+	// ReasonDownload: a file could not be downloaded or read.
+	ReasonDownload Reason = "download"
+	// ReasonInvalid: a file or a reference is malformed.
+	ReasonInvalid Reason = "invalid"
+	// ReasonNotAllowed: a reference points outside the allowed locations.
+	ReasonNotAllowed Reason = "not_allowed"
+	// ReasonTooManyFiles: the specification refers to too many files.
+	ReasonTooManyFiles Reason = "too_many_files"
+	// ReasonTooLarge: a file is larger than the size limit.
+	ReasonTooLarge Reason = "too_large"
+	// ReasonUnknown: the error has not been raised by Fetch.
+	ReasonUnknown Reason = "unknown"
+)
+
+// Error is a failure of Fetch.
+type Error struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorReason returns the reason of a failure of Fetch.
+func ErrorReason(err error) Reason {
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe.Reason
+	}
+	return ReasonUnknown
+}
+
+func fail(reason Reason, err error) error {
+	return &Error{Reason: reason, Err: err}
+}
+
+// Spec is an OpenAPI specification along with the files it refers to,
+// mirrored in a local directory where every reference is relative.
+type Spec struct {
+	// Dir is the directory holding the mirrored files.
+	Dir string
+	// Root is the path of the root document, directly in Dir.
+	Root string
+	// Files maps the location of each fetched file to its path relative to Dir.
+	Files map[string]string
+	// Digest is the sha256 of the fetched files and of their locations.
+	Digest string
+	// Size is the total size of the fetched files, in bytes.
+	Size int64
+}
+
+// Fetch downloads the specification at source and, recursively, all the
+// files referenced by its $refs into dir. References are resolved
+// relative to the file they appear in and rewritten to the local copies.
+//
+// The source can be an http(s) URL, a local path, any go-getter source,
+// or a bundle archive followed by the path of the root document in it
+// (e.g. https://example.com/specs.tgz//openapi.yaml).
+//
+// Remote references must point to the host of the source or to one of
+// the allowed hosts. Local references must stay in the directory of the
+// source (or of the bundle).
+func Fetch(ctx context.Context, source string, dir string, opts Options) (*Spec, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultMaxFiles
+	}
+
+	f := &fetcher{
+		ctx:     ctx,
+		opts:    opts,
+		dir:     dir,
+		files:   map[string]string{},
+		content: map[string][]byte{},
+	}
+	f.opts.Client = f.checkRedirects(opts.Client)
+
+	root, cleanup, err := f.locate(source)
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.fetchAll(root); err != nil {
+		return nil, err
+	}
+
+	size := int64(0)
+	for _, el := range f.content {
+		size += int64(len(el))
+	}
+
+	return &Spec{
+		Dir:    dir,
+		Root:   filepath.Join(dir, f.files[root.String()]),
+		Files:  f.files,
+		Digest: f.digest(),
+		Size:   size,
+	}, nil
+}
+
+type fetcher struct {
+	ctx  context.Context
+	opts Options
+	dir  string
+	// host of the source, always allowed
+	host string
+	// directory local references must stay in
+	localRoot string
+	// k=location v=path relative to dir
+	files map[string]string
+	// k=location v=original content
+	content map[string][]byte
+}
+
+// locate returns the location of the root document, downloading it first
+// when it is a bundle or a go-getter source.
+func (f *fetcher) locate(source string) (*url.URL, func(), error) {
+	src, subDir := fgetter.SourceDirSubdir(source)
+	if isArchive(src) {
+		if len(subDir) == 0 {
+			return nil, nil, fail(ReasonInvalid, fmt.Errorf("missing the path of the root document in bundle '%s' (e.g. %s//openapi.yaml)", src, src))
+		}
+
+		tmp, err := os.MkdirTemp("", "specfetch-")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup := func() { os.RemoveAll(tmp) }
+
+		if err := fgetter.GetAny(tmp, src, fgetter.WithContext(f.ctx)); err != nil {
+			return nil, cleanup, fail(ReasonDownload, fmt.Errorf("downloading bundle '%s': %w", src, err))
+		}
+		f.localRoot = tmp
+		return fileURL(filepath.Join(tmp, subDir)), cleanup, nil
+	}
+
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		f.host = u.Host
+		return u, nil, nil
+	}
+
+	if fi, err := os.Stat(source); err == nil && !fi.IsDir() {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.localRoot = filepath.Dir(abs)
+		return fileURL(abs), nil, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "specfetch-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	dst := filepath.Join(tmp, path.Base(src))
+	if err := fgetter.GetFile(dst, source, fgetter.WithContext(f.ctx)); err != nil {
+		return nil, cleanup, fail(ReasonDownload, fmt.Errorf("downloading '%s': %w", source, err))
+	}
+	f.localRoot = tmp
+	return fileURL(dst), cleanup, nil
+}
+
+// fetchAll fetches the root document and the files it refers to, breadth first.
+func (f *fetcher) fetchAll(root *url.URL) error {
+	f.files[root.String()] = path.Base(root.Path)
+
+	queue := []*url.URL{root}
+	for len(queue) > 0 {
+		loc := queue[0]
+		queue = queue[1:]
+
+		dat, err := f.read(loc)
+		if err != nil {
+			reason := ReasonDownload
+			if r := ErrorReason(err); r == ReasonNotAllowed || r == ReasonTooLarge {
+				reason = r
+			}
+			return fail(reason, fmt.Errorf("fetching '%s': %w", loc, err))
+		}
+		f.content[loc.String()] = dat
+
+		doc := yaml.Node{}
+		if err := yaml.Unmarshal(dat, &doc); err != nil {
+			return fail(ReasonInvalid, fmt.Errorf("parsing '%s': %w", loc, err))
+		}
+
+		var refErr error
+		walkRefs(&doc, func(ref *yaml.Node) {
+			if refErr != nil {
+				return
+			}
+
+			target, fragment, err := f.resolve(loc, ref.Value)
+			if err != nil {
+				refErr = err
+				return
+			}
+			if target == nil {
+				return
+			}
+
+			if _, ok := f.files[target.String()]; !ok {
+				if len(f.files) >= f.opts.MaxFiles {
+					refErr = fail(ReasonTooManyFiles, fmt.Errorf("too many referenced files (max %d)", f.opts.MaxFiles))
+					return
+				}
+				f.files[target.String()] = localPath(target)
+				queue = append(queue, target)
+			}
+
+			rel, err := filepath.Rel(filepath.Dir(f.files[loc.String()]), f.files[target.String()])
+			if err != nil {
+				refErr = err
+				return
+			}
+			ref.Value = filepath.ToSlash(rel)
+			if len(fragment) > 0 {
+				ref.Value = fmt.Sprintf("%s#%s", ref.Value, fragment)
+			}
+		})
+		if refErr != nil {
+			return fmt.Errorf("resolving references of '%s': %w", loc, refErr)
+		}
+
+		if err := f.write(f.files[loc.String()], &doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the location of the file a reference points to and the
+// fragment in it. The location is nil for references inside the same file.
+func (f *fetcher) resolve(base *url.URL, ref string) (*url.URL, string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, "", fail(ReasonInvalid, fmt.Errorf("invalid reference '%s': %w", ref, err))
+	}
+	if len(u.Scheme) == 0 && len(u.Host) == 0 && len(u.Path) == 0 {
+		return nil, "", nil
+	}
+
+	res := base.ResolveReference(u)
+	fragment := res.Fragment
+	res.Fragment, res.RawFragment = "", ""
+
+	if err := f.allowed(res); err != nil {
+		return nil, "", err
+	}
+	return res, fragment, nil
+}
+
+// Client returns a copy of client following only the redirects to the host
+// of source or to one of the allowed hosts, as the client of Fetch does.
+func Client(client *http.Client, source *url.URL, allowedHosts []string) *http.Client {
+	f := &fetcher{
+		opts: Options{AllowedHosts: allowedHosts},
+		host: source.Host,
+	}
+	return f.checkRedirects(client)
+}
+
+// checkRedirects returns a copy of client following only the redirects to
+// allowed locations, so that an allowed host cannot redirect a fetch
+// anywhere else.
+func (f *fetcher) checkRedirects(client *http.Client) *http.Client {
+	res := *client
+	next := client.CheckRedirect
+	res.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := f.allowed(req.URL); err != nil {
+			return fmt.Errorf("redirect to '%s': %w", req.URL, err)
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return &res
+}
+
+// allowed checks that a location can be fetched.
+func (f *fetcher) allowed(loc *url.URL) error {
+	switch loc.Scheme {
+	case "http", "https":
+		if strings.EqualFold(loc.Host, f.host) {
+			return nil
+		}
+		for _, el := range f.opts.AllowedHosts {
+			if strings.EqualFold(loc.Host, el) || strings.EqualFold(loc.Hostname(), el) {
+				return nil
+			}
+		}
+		return fail(ReasonNotAllowed, fmt.Errorf("host '%s' is not allowed", loc.Host))
+
+	case "file":
+		if len(f.localRoot) == 0 {
+			return fail(ReasonNotAllowed, fmt.Errorf("local reference '%s' not allowed in a remote document", loc.Path))
+		}
+		rel, err := filepath.Rel(f.localRoot, filepath.FromSlash(loc.Path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fail(ReasonNotAllowed, fmt.Errorf("local reference '%s' is outside of '%s'", loc.Path, f.localRoot))
+		}
+		return nil
+	}
+
+	return fail(ReasonNotAllowed, fmt.Errorf("unsupported reference scheme '%s'", loc.Scheme))
+}
+
+func (f *fetcher) read(loc *url.URL) ([]byte, error) {
+	if loc.Scheme == "file" {
+		fp, err := os.Open(filepath.FromSlash(loc.Path))
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		return readFile(fp)
+	}
+
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodGet, loc.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return readFile(resp.Body)
+}
+
+// readFile reads a file of at most maxFileSize bytes: a larger one fails
+// instead of being truncated into a different document.
+func readFile(r io.Reader) ([]byte, error) {
+	dat, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxFileSize {
+		return nil, fail(ReasonTooLarge, fmt.Errorf("file larger than %d bytes", maxFileSize))
+	}
+	return dat, nil
+}
+
+func (f *fetcher) write(name string, doc *yaml.Node) error {
+	dst := filepath.Join(f.dir, name)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	buf := bytes.Buffer{}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, buf.Bytes(), 0644)
+}
+
+// digest hashes the fetched files, sorted by location.
+func (f *fetcher) digest() string {
+	locs := make([]string, 0, len(f.content))
+	for k := range f.content {
+		locs = append(locs, k)
+	}
+	sort.Strings(locs)
+
+	h := sha256.New()
+	for _, el := range locs {
+		// the root location changes with the temporary directories,
+		// only its relative path is hashed
+		h.Write([]byte(f.files[el]))
+		h.Write([]byte{0})
+		h.Write(f.content[el])
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// walkRefs calls fn for each $ref value node.
+func walkRefs(node *yaml.Node, fn func(*yaml.Node)) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if key.Value == "$ref" && val.Kind == yaml.ScalarNode {
+				fn(val)
+				continue
+			}
+			walkRefs(val, fn)
+		}
+		return
+	}
+
+	for _, el := range node.Content {
+		walkRefs(el, fn)
+	}
+}
+
+// localPath returns the path of the local copy of a file, relative to the
+// fetch directory. The root document is the only file directly in it.
+func localPath(loc *url.URL) string {
+	host := "_local"
+	if loc.Scheme != "file" {
+		host = strings.ReplaceAll(loc.Host, ":", "_")
+	}
+	return filepath.Join("_refs", host, filepath.FromSlash(path.Clean("/"+loc.Path)))
+}
+
+func fileURL(p string) *url.URL {
+	return &url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+}
+
+func isArchive(src string) bool {
+	u, err := url.Parse(src)
+	if err == nil && len(u.Query().Get("archive")) > 0 {
+		return true
+	}
+
+	p := src
+	if err == nil {
+		p = u.Path
+	}
+	for _, el := range archiveExtensions {
+		if strings.HasSuffix(strings.ToLower(p), el) {
+			return true
+		}
+	}
+	return false
+}
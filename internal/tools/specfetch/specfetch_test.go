@@ -0,0 +1,289 @@
+package specfetch
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pb33f/libopenapi"
+	"github.com/pb33f/libopenapi/datamodel"
+)
+
+const rootDoc = `openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: 'schemas/pet.yaml'
+      responses:
+        '200':
+          description: OK
+`
+
+const petDoc = `type: object
+properties:
+  name:
+    type: string
+  owner:
+    $ref: '../common.yaml#/Owner'
+  tags:
+    $ref: '%s/tags.yaml'
+`
+
+const commonDoc = `Owner:
+  type: object
+  properties:
+    email:
+      type: string
+`
+
+const tagsDoc = `type: array
+items:
+  type: string
+`
+
+func serve(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dat, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(dat))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func setup(t *testing.T) (string, string) {
+	t.Helper()
+	remote := serve(t, map[string]string{"/tags.yaml": tagsDoc})
+	u, _ := url.Parse(remote.URL)
+
+	srv := serve(t, map[string]string{
+		"/specs/openapi.yaml":     rootDoc,
+		"/specs/schemas/pet.yaml": strings.Replace(petDoc, "%s", remote.URL, 1),
+		"/specs/common.yaml":      commonDoc,
+	})
+	return srv.URL + "/specs/openapi.yaml", u.Host
+}
+
+func TestFetch(t *testing.T) {
+	source, host := setup(t)
+
+	dir := t.TempDir()
+	spec, err := Fetch(context.TODO(), source, dir, Options{AllowedHosts: []string{host}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spec.Files) != 4 {
+		t.Fatalf("expected 4 files, got %d: %v", len(spec.Files), spec.Files)
+	}
+	if spec.Size == 0 {
+		t.Error("expected the size of the fetched files")
+	}
+	if spec.Root != filepath.Join(dir, "openapi.yaml") {
+		t.Fatalf("unexpected root: %s", spec.Root)
+	}
+
+	dat, err := os.ReadFile(filepath.Join(dir, spec.Files[strings.Replace(source, "openapi.yaml", "schemas/pet.yaml", 1)]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dat), "../common.yaml#/Owner") {
+		t.Errorf("relative reference not preserved:\n%s", dat)
+	}
+	if strings.Contains(string(dat), "http://") {
+		t.Errorf("remote reference not rewritten:\n%s", dat)
+	}
+
+	contents, err := os.ReadFile(spec.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := libopenapi.NewDocumentWithConfiguration(contents, &datamodel.DocumentConfiguration{
+		BasePath:            spec.Dir,
+		AllowFileReferences: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, errs := doc.BuildV3Model()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	schema := model.Model.Paths.PathItems.GetOrZero("/pets").Post.RequestBody.Content.GetOrZero("application/json").Schema.Schema()
+	if _, ok := schema.Properties.Get("owner"); !ok {
+		t.Errorf("expected the owner property to be resolved")
+	}
+}
+
+func TestFetchDigest(t *testing.T) {
+	source, host := setup(t)
+
+	first, err := Fetch(context.TODO(), source, t.TempDir(), Options{AllowedHosts: []string{host}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Fetch(context.TODO(), source, t.TempDir(), Options{AllowedHosts: []string{host}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Digest != second.Digest {
+		t.Errorf("expected the same digest, got %s and %s", first.Digest, second.Digest)
+	}
+}
+
+func TestFetchDisallowedHost(t *testing.T) {
+	source, _ := setup(t)
+
+	_, err := Fetch(context.TODO(), source, t.TempDir(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("expected a disallowed host error, got: %v", err)
+	}
+	if got := ErrorReason(err); got != ReasonNotAllowed {
+		t.Errorf("expected reason %s, got %s", ReasonNotAllowed, got)
+	}
+}
+
+func TestFetchLocal(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "schemas"), os.ModePerm)
+	os.WriteFile(filepath.Join(src, "openapi.yaml"), []byte(rootDoc), 0644)
+	os.WriteFile(filepath.Join(src, "common.yaml"), []byte(commonDoc), 0644)
+	os.WriteFile(filepath.Join(src, "schemas", "pet.yaml"),
+		[]byte(strings.Replace(petDoc, "%s/tags.yaml", "../../outside.yaml", 1)), 0644)
+
+	_, err := Fetch(context.TODO(), filepath.Join(src, "openapi.yaml"), t.TempDir(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "is outside of") {
+		t.Fatalf("expected an outside reference error, got: %v", err)
+	}
+}
+
+func TestFetchBundle(t *testing.T) {
+	src := t.TempDir()
+	bundle := filepath.Join(src, "specs.tgz")
+
+	fp, err := os.Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(fp)
+	tw := tar.NewWriter(gz)
+	for name, dat := range map[string]string{
+		"openapi.yaml":     rootDoc,
+		"common.yaml":      commonDoc,
+		"schemas/pet.yaml": strings.Replace(petDoc, "%s/tags.yaml", "../common.yaml#/Owner", 1),
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(dat))})
+		tw.Write([]byte(dat))
+	}
+	tw.Close()
+	gz.Close()
+	fp.Close()
+
+	spec, err := Fetch(context.TODO(), bundle+"//openapi.yaml", t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Files) != 3 {
+		t.Fatalf("expected 3 files, got %d: %v", len(spec.Files), spec.Files)
+	}
+}
+
+func TestFetchErrorReason(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := Fetch(context.TODO(), srv.URL+"/openapi.yaml", t.TempDir(), Options{})
+	if got := ErrorReason(err); got != ReasonDownload {
+		t.Errorf("expected reason %s, got %s: %v", ReasonDownload, got, err)
+	}
+
+	if got := ErrorReason(errors.New("other")); got != ReasonUnknown {
+		t.Errorf("expected reason %s, got %s", ReasonUnknown, got)
+	}
+}
+
+func TestFetchRedirect(t *testing.T) {
+	outside := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("openapi: 3.0.0\n"))
+	}))
+	defer outside.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/outside.yaml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, outside.URL+"/openapi.yaml", http.StatusFound)
+	})
+	mux.HandleFunc("/moved.yaml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/openapi.yaml", http.StatusFound)
+	})
+	mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("openapi: 3.0.0\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	_, err := Fetch(context.TODO(), srv.URL+"/outside.yaml", t.TempDir(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("expected the redirect to a disallowed host to fail, got: %v", err)
+	}
+	if got := ErrorReason(err); got != ReasonNotAllowed {
+		t.Errorf("expected reason %s, got %s", ReasonNotAllowed, got)
+	}
+
+	if _, err := Fetch(context.TODO(), srv.URL+"/moved.yaml", t.TempDir(), Options{}); err != nil {
+		t.Errorf("expected a redirect on the same host to be followed, got: %v", err)
+	}
+}
+
+func TestFetchTooLarge(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(local, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(local, maxFileSize+1); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, io.LimitReader(zeros{}, maxFileSize+1))
+	}))
+	defer srv.Close()
+
+	for _, source := range []string{local, srv.URL + "/openapi.yaml"} {
+		_, err := Fetch(context.TODO(), source, t.TempDir(), Options{})
+		if err == nil || !strings.Contains(err.Error(), "file larger than") {
+			t.Errorf("%s: expected a file too large error, got: %v", source, err)
+		}
+		if got := ErrorReason(err); got != ReasonTooLarge {
+			t.Errorf("%s: expected reason %s, got %s", source, ReasonTooLarge, got)
+		}
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}